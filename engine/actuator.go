@@ -0,0 +1,31 @@
+package engine
+
+import (
+	"context"
+	"time"
+
+	"github.com/rinzlerlabs/viam-fan-controller/utils"
+)
+
+// Actuator drives the fans. Every method is called with the controller's lock held.
+type Actuator interface {
+	// Apply drives the fans towards level, from 0-1, as the strategy asked. It can take its time getting
+	// there, e.g. staggering fan starts or holding a relay for its minimum on time.
+	Apply(ctx context.Context, now time.Time, level float64) error
+	// Force drives the fans straight to level, for manual overrides, the failsafe and closing
+	Force(ctx context.Context, level float64) error
+	// State is what the fans are doing now
+	State(ctx context.Context) (State, error)
+	// Outputs is everything the actuator drives, they're claimed so no other controller can drive them too
+	Outputs() []utils.Output
+	// Stop turns off any of outputs this actuator drives, they've been dropped from the config or handed to another controller
+	Stop(ctx context.Context, outputs []utils.Output) error
+	// Readings are the actuator's own values for the controller's readings
+	Readings(ctx context.Context) (map[string]interface{}, error)
+}
+
+// Closer is an actuator with something to finish up when the controller closes, like saving state to disk.
+// It's called with the controller's lock held, after the on_close policy.
+type Closer interface {
+	Close(ctx context.Context) error
+}
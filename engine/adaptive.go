@@ -0,0 +1,364 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"go.viam.com/rdk/resource"
+
+	"github.com/rinzlerlabs/viam-fan-controller/utils"
+)
+
+const (
+	defaultAdaptiveStep       = 5.0
+	defaultAdaptiveMargin     = 1.0
+	defaultAdaptiveSettleTime = 10 * time.Minute
+	// How many observations are kept for each table point
+	maxObservations = 20
+
+	CommandGetLearnedTable = "get_learned_table"
+	CommandExportTable     = "export_table"
+	CommandResetLearning   = "reset_learning"
+)
+
+// adaptiveConfig is the table strategy's adaptive attribute, duties are in percent
+type adaptiveConfig struct {
+	Ceiling    *float64 `json:"ceiling"`
+	MinDuty    float64  `json:"min_duty"`
+	MaxDuty    *float64 `json:"max_duty"`
+	Step       float64  `json:"step"`
+	Margin     *float64 `json:"margin"`
+	SettleTime int64    `json:"settle_time"`
+}
+
+// observation is how the temperature responded to a table point's duty over one settle window
+type observation struct {
+	Time            time.Time `json:"time"`
+	DutyPct         float64   `json:"duty_pct"`
+	PeakTemperature float64   `json:"peak_temperature"`
+	Seconds         float64   `json:"seconds"`
+	// What was done about it: lowered, raised or held
+	Action string `json:"action"`
+}
+
+// learnedState is what's saved to disk, so a restart doesn't throw away what was learned
+type learnedState struct {
+	TemperatureTable map[string]float64       `json:"temperature_table"`
+	Observations     map[string][]observation `json:"observations"`
+}
+
+// adaptive learns the lowest duty at each table point that keeps the temperature under the ceiling. Each point is
+// judged over a settle window: if the temperature stayed comfortably under the ceiling the point is lowered a step,
+// and if it reached the ceiling the point is raised a step straight away and the fans run at the max duty until
+// it's back under.
+type adaptive struct {
+	Ceiling    float64
+	MinDuty    float64
+	MaxDuty    float64
+	Step       float64
+	Margin     float64
+	SettleTime time.Duration
+	statePath  string
+	// The table as configured, to go back to on a reset
+	configured   map[float64]float64
+	observations map[float64][]observation
+	// The point being judged, and the window so far
+	point     float64
+	hasPoint  bool
+	since     time.Time
+	peak      float64
+	over      bool
+	saveError error
+}
+
+func newAdaptive(path string, conf *adaptiveConfig, table map[float64]float64) (*adaptive, []utils.ConfigWarning, error) {
+	if conf.Ceiling == nil {
+		return nil, nil, resource.NewConfigValidationFieldRequiredError(path, "adaptive.ceiling")
+	}
+	a := &adaptive{
+		Ceiling:      *conf.Ceiling,
+		MinDuty:      conf.MinDuty / 100,
+		MaxDuty:      1,
+		Step:         defaultAdaptiveStep / 100,
+		Margin:       defaultAdaptiveMargin,
+		SettleTime:   defaultAdaptiveSettleTime,
+		configured:   make(map[float64]float64, len(table)),
+		observations: make(map[float64][]observation),
+	}
+	if conf.MaxDuty != nil {
+		a.MaxDuty = *conf.MaxDuty / 100
+	}
+	if conf.MinDuty < 0 || a.MaxDuty > 1 || a.MinDuty >= a.MaxDuty {
+		return nil, nil, utils.NewFieldError(path, "adaptive", "min_duty and max_duty must be from 0 to 100 and min_duty must be lower, got %v and %v", conf.MinDuty, a.MaxDuty*100)
+	}
+	if conf.Step < 0 || conf.Step > 100 {
+		return nil, nil, utils.NewFieldError(path, "adaptive.step", "must be from 0 to 100, got %v", conf.Step)
+	}
+	if conf.Step > 0 {
+		a.Step = conf.Step / 100
+	}
+	if conf.Margin != nil {
+		if *conf.Margin < 0 {
+			return nil, nil, utils.NewFieldError(path, "adaptive.margin", "cannot be negative, got %v", *conf.Margin)
+		}
+		a.Margin = *conf.Margin
+	}
+	if err := utils.ValidateDelay(path, "adaptive.settle_time", conf.SettleTime); err != nil {
+		return nil, nil, err
+	}
+	if conf.SettleTime > 0 {
+		a.SettleTime = time.Duration(conf.SettleTime) * time.Second
+	}
+
+	warnings := []utils.ConfigWarning{}
+	for temp, duty := range table {
+		a.configured[temp] = duty
+		if duty < a.MinDuty || duty > a.MaxDuty {
+			warnings = append(warnings, utils.NewConfigWarning(path, fmt.Sprintf("temperature_table[%q]", formatTemp(temp)), "duty %v%% is outside min_duty and max_duty, it will be learned from the nearest bound", duty*100))
+		}
+	}
+
+	// The module data directory is the only place we can count on being able to write to
+	if dataDir := os.Getenv("VIAM_MODULE_DATA"); dataDir != "" {
+		a.statePath = filepath.Join(dataDir, path+"-learned-table.json")
+	} else {
+		warnings = append(warnings, utils.NewConfigWarning(path, "adaptive", "VIAM_MODULE_DATA is not set, the learned table will not survive a restart"))
+	}
+	return a, warnings, nil
+}
+
+func formatTemp(temp float64) string {
+	return strconv.FormatFloat(temp, 'f', -1, 64)
+}
+
+func (a *adaptive) clamp(duty float64) float64 {
+	return math.Max(a.MinDuty, math.Min(a.MaxDuty, duty))
+}
+
+// restore fills the table with what was learned before, from the running table if it has the same points,
+// otherwise from disk. Points that weren't learned yet start from the configured duty.
+func (a *adaptive) restore(table map[float64]float64, previous *Table) {
+	learned := make(map[float64]float64, len(table))
+	if previous != nil && previous.adaptive != nil && sameTemps(previous.TemperatureTable, table) {
+		learned = previous.TemperatureTable
+		a.observations = previous.adaptive.observations
+	} else if state, err := loadLearnedState(a.statePath); err == nil {
+		for ts, duty := range state.TemperatureTable {
+			if temp, err := strconv.ParseFloat(ts, 64); err == nil {
+				learned[temp] = duty / 100
+			}
+		}
+		for ts, observations := range state.Observations {
+			if temp, err := strconv.ParseFloat(ts, 64); err == nil {
+				if _, ok := table[temp]; ok {
+					a.observations[temp] = observations
+				}
+			}
+		}
+	}
+
+	for temp := range table {
+		if duty, ok := learned[temp]; ok {
+			table[temp] = duty
+		}
+		table[temp] = a.clamp(table[temp])
+	}
+}
+
+func sameTemps(a, b map[float64]float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for temp := range a {
+		if _, ok := b[temp]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// observe judges the active table point against the latest temperature, and adjusts the table when a window ends.
+// It returns true while the temperature is over the ceiling and the fans should run at the max duty.
+func (a *adaptive) observe(t *Table, point float64, m Measurement) bool {
+	if !a.hasPoint || point != a.point {
+		a.point, a.hasPoint = point, true
+		a.startWindow(m)
+	}
+	a.peak = math.Max(a.peak, m.Value)
+
+	if m.Value < a.Ceiling {
+		a.over = false
+	} else if !a.over || m.Time.Sub(a.since) >= a.SettleTime {
+		// Raise as soon as the ceiling is reached, and again each window it stays there
+		a.over = true
+		a.adjust(t, m, "raised", t.TemperatureTable[point]+a.Step)
+		return true
+	}
+
+	if m.Time.Sub(a.since) >= a.SettleTime {
+		if a.peak < a.Ceiling-a.Margin {
+			a.adjust(t, m, "lowered", t.TemperatureTable[point]-a.Step)
+		} else {
+			a.adjust(t, m, "held", t.TemperatureTable[point])
+		}
+	}
+	return a.over
+}
+
+func (a *adaptive) startWindow(m Measurement) {
+	a.since = m.Time
+	a.peak = m.Value
+}
+
+// adjust moves the active point to duty and records why. The table is kept in order, a point never runs slower
+// than a cooler one.
+func (a *adaptive) adjust(t *Table, m Measurement, action string, duty float64) {
+	old := t.TemperatureTable[a.point]
+	duty = a.clamp(duty)
+	for _, temp := range t.Temps {
+		switch {
+		case temp > a.point && duty > old:
+			t.TemperatureTable[temp] = math.Max(t.TemperatureTable[temp], duty)
+		case temp < a.point && duty < old:
+			duty = math.Max(duty, t.TemperatureTable[temp])
+		}
+	}
+	t.TemperatureTable[a.point] = duty
+
+	observations := append(a.observations[a.point], observation{
+		Time:            m.Time,
+		DutyPct:         old * 100,
+		PeakTemperature: a.peak,
+		Seconds:         m.Time.Sub(a.since).Seconds(),
+		Action:          action,
+	})
+	if len(observations) > maxObservations {
+		observations = observations[len(observations)-maxObservations:]
+	}
+	a.observations[a.point] = observations
+	a.startWindow(m)
+
+	if duty != old {
+		a.saveError = a.save(t)
+	}
+}
+
+func (a *adaptive) save(t *Table) error {
+	if a.statePath == "" {
+		return nil
+	}
+	state := learnedState{
+		TemperatureTable: percentTable(t.TemperatureTable),
+		Observations:     make(map[string][]observation, len(a.observations)),
+	}
+	for temp, observations := range a.observations {
+		state.Observations[formatTemp(temp)] = observations
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	// Write then rename so a crash mid write never leaves a truncated table behind
+	tmp := a.statePath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, a.statePath)
+}
+
+func loadLearnedState(path string) (*learnedState, error) {
+	if path == "" {
+		return nil, os.ErrNotExist
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	state := &learnedState{}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// percentTable is a table in the same format as temperature_table in the config
+func percentTable(table map[float64]float64) map[string]float64 {
+	result := make(map[string]float64, len(table))
+	for temp, duty := range table {
+		result[formatTemp(temp)] = math.Round(duty*10000) / 100
+	}
+	return result
+}
+
+func (a *adaptive) diagnostics(t *Table) map[string]interface{} {
+	diagnostics := map[string]interface{}{
+		"learning_point":   a.point,
+		"learned_duty_pct": t.TemperatureTable[a.point] * 100,
+		"over_ceiling":     a.over,
+	}
+	if a.saveError != nil {
+		diagnostics["learning_error"] = a.saveError.Error()
+	}
+	return diagnostics
+}
+
+func (a *adaptive) doCommand(ctx context.Context, t *Table, cmd map[string]interface{}) (map[string]interface{}, error) {
+	switch cmd["command"] {
+	case CommandGetLearnedTable:
+		observations := make(map[string]interface{}, len(a.observations))
+		for temp, list := range a.observations {
+			entries := make([]interface{}, 0, len(list))
+			for _, o := range list {
+				entries = append(entries, map[string]interface{}{
+					"time":             o.Time.Format(time.RFC3339),
+					"duty_pct":         o.DutyPct,
+					"peak_temperature": o.PeakTemperature,
+					"seconds":          o.Seconds,
+					"action":           o.Action,
+				})
+			}
+			observations[formatTemp(temp)] = entries
+		}
+		return map[string]interface{}{
+			"temperature_table": tableResult(t.TemperatureTable),
+			"configured_table":  tableResult(a.configured),
+			"observations":      observations,
+			"ceiling":           a.Ceiling,
+			"min_duty":          a.MinDuty * 100,
+			"max_duty":          a.MaxDuty * 100,
+		}, nil
+	case CommandExportTable:
+		return map[string]interface{}{"temperature_table": tableResult(t.TemperatureTable)}, nil
+	case CommandResetLearning:
+		for temp, duty := range a.configured {
+			t.TemperatureTable[temp] = a.clamp(duty)
+		}
+		a.observations = make(map[float64][]observation)
+		a.hasPoint = false
+		a.over = false
+		a.saveError = nil
+		if a.statePath != "" {
+			if err := os.Remove(a.statePath); err != nil && !os.IsNotExist(err) {
+				return nil, fmt.Errorf("error removing learned table: %w", err)
+			}
+		}
+		return map[string]interface{}{"temperature_table": tableResult(t.TemperatureTable)}, nil
+	default:
+		return nil, fmt.Errorf("unknown command %v, must be one of %s, %s or %s", cmd["command"], CommandGetLearnedTable, CommandExportTable, CommandResetLearning)
+	}
+}
+
+// tableResult is a percent table as DoCommand can return it
+func tableResult(table map[float64]float64) map[string]interface{} {
+	result := make(map[string]interface{}, len(table))
+	for temp, duty := range percentTable(table) {
+		result[temp] = duty
+	}
+	return result
+}
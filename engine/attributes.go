@@ -0,0 +1,81 @@
+package engine
+
+import (
+	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/resource"
+
+	"github.com/rinzlerlabs/viam-fan-controller/utils"
+)
+
+// LoopAttributes is the sensor and control loop config every model shares. Models embed it in their config, squashed
+// so the attributes stay at the top level.
+type LoopAttributes struct {
+	SensorName       string   `json:"sensor_name"`
+	SensorValueKey   string   `json:"sensor_value_key"`
+	SensorValueRegex string   `json:"sensor_value_regex"`
+	OnClose          string   `json:"on_close"`
+	OperationTimeout int64    `json:"operation_timeout"`
+	WatchdogTimeout  int64    `json:"watchdog_timeout"`
+	FailsafeDuty     *float64 `json:"failsafe_duty"`
+	PollInterval     float64  `json:"poll_interval"`
+	MaxBackoff       int64    `json:"max_backoff"`
+}
+
+// Validate checks the sensor, on_close and control loop attributes
+func (a *LoopAttributes) Validate(path string) error {
+	if a.SensorName == "" {
+		return resource.NewConfigValidationFieldRequiredError(path, "sensor_name")
+	}
+
+	if a.SensorValueKey == "" {
+		return resource.NewConfigValidationFieldRequiredError(path, "sensor_value_key")
+	}
+
+	if err := utils.ValidateRegex(path, "sensor_value_regex", a.SensorValueRegex); err != nil {
+		return err
+	}
+
+	if _, err := utils.ParseClosePolicy(path, "on_close", a.OnClose); err != nil {
+		return err
+	}
+
+	if _, err := utils.ParseLoopSettings(path, a.LoopConfig()); err != nil {
+		return err
+	}
+	return nil
+}
+
+// LoopConfig pulls out the control loop config
+func (a *LoopAttributes) LoopConfig() utils.LoopConfig {
+	return utils.LoopConfig{
+		PollInterval:     a.PollInterval,
+		MaxBackoff:       a.MaxBackoff,
+		OperationTimeout: a.OperationTimeout,
+		WatchdogTimeout:  a.WatchdogTimeout,
+		FailsafeDuty:     a.FailsafeDuty,
+	}
+}
+
+// Common is the shared config for NewSettings, models with inputs, humidity or overrides fill those in on top
+func (a *LoopAttributes) Common() Common {
+	return Common{
+		SensorName:       a.SensorName,
+		SensorValueKey:   a.SensorValueKey,
+		SensorValueRegex: a.SensorValueRegex,
+		OnClose:          a.OnClose,
+		Loop:             a.LoopConfig(),
+	}
+}
+
+// LogConfigWarnings runs a model's validate again from Build and logs what it warns about. Validate has already been
+// run by then, but the warnings are only available here.
+func LogConfigWarnings(path string, validate func(path string) ([]string, []utils.ConfigWarning, error), logger logging.Logger) error {
+	_, warnings, err := validate(path)
+	if err != nil {
+		return err
+	}
+	for _, warning := range warnings {
+		logger.Warnf("Config warning: %s", warning)
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.viam.com/rdk/resource"
+	rdkutils "go.viam.com/rdk/utils"
+)
+
+// modelConfig embeds the shared attributes the way the models do
+type modelConfig struct {
+	LoopAttributes `json:",squash"`
+	BoardName      string `json:"board_name"`
+}
+
+func TestLoopAttributesAtTopLevel(t *testing.T) {
+	conf, err := resource.TransformAttributeMap[*modelConfig](rdkutils.AttributeMap{
+		"board_name":       "pi",
+		"sensor_name":      "temps",
+		"sensor_value_key": "temp",
+		"on_close":         "stop",
+		"poll_interval":    0.5,
+		"failsafe_duty":    80.0,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "pi", conf.BoardName)
+	assert.Equal(t, "temps", conf.SensorName)
+	assert.Equal(t, "temp", conf.SensorValueKey)
+	assert.Equal(t, "stop", conf.Common().OnClose)
+	assert.Equal(t, 0.5, conf.LoopConfig().PollInterval)
+	assert.Equal(t, 80.0, *conf.Common().Loop.FailsafeDuty)
+}
+
+func TestLoopAttributesValidate(t *testing.T) {
+	valid := LoopAttributes{SensorName: "temps", SensorValueKey: "temp"}
+	assert.NoError(t, valid.Validate("fan"))
+
+	for _, tc := range []struct {
+		name  string
+		attrs LoopAttributes
+		field string
+	}{
+		{"missing sensor", LoopAttributes{SensorValueKey: "temp"}, "sensor_name"},
+		{"missing key", LoopAttributes{SensorName: "temps"}, "sensor_value_key"},
+		{"bad regex", LoopAttributes{SensorName: "temps", SensorValueKey: "temp", SensorValueRegex: "("}, "sensor_value_regex"},
+		{"bad close policy", LoopAttributes{SensorName: "temps", SensorValueKey: "temp", OnClose: "explode"}, "on_close"},
+		{"negative poll interval", LoopAttributes{SensorName: "temps", SensorValueKey: "temp", PollInterval: -1}, "poll_interval"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.ErrorContains(t, tc.attrs.Validate("fan"), tc.field)
+		})
+	}
+}
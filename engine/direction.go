@@ -0,0 +1,42 @@
+package engine
+
+import (
+	"github.com/rinzlerlabs/viam-fan-controller/utils"
+)
+
+// Direction is which way the fans move the temperature, it decides which side of a threshold calls for them
+type Direction string
+
+const (
+	// The fans run harder as the temperature rises, the default
+	DirectionCooling Direction = "cooling"
+	// The fans run harder as the temperature drops, e.g. to move warm air from a heater
+	DirectionHeating Direction = "heating"
+)
+
+// ParseDirection parses the direction attribute, nothing set means cooling
+func ParseDirection(path string, raw string) (Direction, error) {
+	switch Direction(raw) {
+	case "", DirectionCooling:
+		return DirectionCooling, nil
+	case DirectionHeating:
+		return DirectionHeating, nil
+	}
+	return "", utils.NewFieldError(path, "direction", "must be %s or %s, got %s", DirectionCooling, DirectionHeating, raw)
+}
+
+// reached is whether the temperature has got to threshold, at or above it when cooling and at or below when heating
+func (d Direction) reached(currentTemp float64, threshold float64) bool {
+	if d == DirectionHeating {
+		return currentTemp <= threshold
+	}
+	return currentTemp >= threshold
+}
+
+// past is how far the temperature is beyond target on the side that calls for the fans, negative if it's short of it
+func (d Direction) past(currentTemp float64, target float64) float64 {
+	if d == DirectionHeating {
+		return target - currentTemp
+	}
+	return currentTemp - target
+}
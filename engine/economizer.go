@@ -0,0 +1,240 @@
+package engine
+
+import (
+	"fmt"
+
+	"github.com/rinzlerlabs/viam-fan-controller/utils"
+)
+
+const StrategyEconomizer = "economizer"
+
+const (
+	defaultOutdoorInput         = "outdoor"
+	defaultOutdoorHumidityInput = "outdoor_humidity"
+	defaultEconomizerMargin     = 2.0
+	defaultEconomizerBand       = 1.0
+	defaultEconomizerDuty       = 100.0
+
+	EconomizerRunning    = "economizing"
+	EconomizerIdle       = "idle"
+	EconomizerLockedOut  = "locked_out"
+	LockoutNone          = "none"
+	LockoutOutdoorHot    = "outdoor_too_hot"
+	LockoutOutdoorCold   = "outdoor_too_cold"
+	LockoutOutdoorHumid  = "outdoor_too_humid"
+	LockoutIndoorCool    = "indoor_cool_enough"
+	LockoutOutdoorWetter = "outdoor_not_drier"
+)
+
+func init() {
+	RegisterStrategy(StrategyEconomizer, newEconomizer)
+}
+
+type economizerConfig struct {
+	// The input the outdoor temperature is read from
+	OutdoorInput string `json:"outdoor_input"`
+	// How much cooler the outdoor air has to be, in degrees
+	Margin *float64 `json:"margin"`
+	// How far the difference can drop below the margin before a running fan stops
+	Band *float64 `json:"band"`
+	// The fan speed to run at, in percent
+	Duty                  *float64 `json:"duty"`
+	MaxOutdoorTemperature *float64 `json:"max_outdoor_temperature"`
+	MinOutdoorTemperature *float64 `json:"min_outdoor_temperature"`
+	// Don't bring the inside any colder than this
+	MinIndoorTemperature *float64 `json:"min_indoor_temperature"`
+	MaxOutdoorHumidity   *float64 `json:"max_outdoor_humidity"`
+	// Only bring outdoor air in when its dew point is lower than inside
+	RequireDrier         bool   `json:"require_drier"`
+	IndoorHumidityInput  string `json:"indoor_humidity_input"`
+	OutdoorHumidityInput string `json:"outdoor_humidity_input"`
+}
+
+// Economizer runs an intake fan to bring outdoor air in whenever it's cooler than inside by a margin, and optionally
+// drier, unless the outdoor air is too hot, cold or humid to use. The controller's temperature is the indoor one.
+type Economizer struct {
+	OutdoorInput          string
+	Margin                float64
+	Band                  float64
+	Duty                  float64
+	MaxOutdoorTemperature *float64
+	MinOutdoorTemperature *float64
+	MinIndoorTemperature  *float64
+	MaxOutdoorHumidity    *float64
+	RequireDrier          bool
+	IndoorHumidityInput   string
+	OutdoorHumidityInput  string
+	running               bool
+}
+
+func newEconomizer(conf StrategyConfig) (Strategy, []utils.ConfigWarning, error) {
+	// Outdoor air is only cooler or warmer, the economizer can't compare anything else
+	if conf.Quantity != "" && conf.Quantity != defaultQuantity {
+		return nil, nil, utils.NewFieldError(conf.Path, "strategy", "%s needs the quantity to be %s, got %s", StrategyEconomizer, defaultQuantity, conf.Quantity)
+	}
+	var econConf economizerConfig
+	if err := DecodeAttributes(conf.Attributes, &econConf); err != nil {
+		return nil, nil, utils.NewFieldError(conf.Path, "strategy_config", "%s", err)
+	}
+
+	e := &Economizer{
+		OutdoorInput:          defaultOutdoorInput,
+		Margin:                defaultEconomizerMargin,
+		Band:                  defaultEconomizerBand,
+		Duty:                  defaultEconomizerDuty / 100,
+		MaxOutdoorTemperature: econConf.MaxOutdoorTemperature,
+		MinOutdoorTemperature: econConf.MinOutdoorTemperature,
+		MinIndoorTemperature:  econConf.MinIndoorTemperature,
+		MaxOutdoorHumidity:    econConf.MaxOutdoorHumidity,
+		RequireDrier:          econConf.RequireDrier,
+		IndoorHumidityInput:   HumidityInput,
+		OutdoorHumidityInput:  defaultOutdoorHumidityInput,
+	}
+	if econConf.OutdoorInput != "" {
+		e.OutdoorInput = econConf.OutdoorInput
+	}
+	if econConf.IndoorHumidityInput != "" {
+		e.IndoorHumidityInput = econConf.IndoorHumidityInput
+	}
+	if econConf.OutdoorHumidityInput != "" {
+		e.OutdoorHumidityInput = econConf.OutdoorHumidityInput
+	}
+
+	if econConf.Margin != nil {
+		if *econConf.Margin < 0 {
+			return nil, nil, utils.NewFieldError(conf.Path, "strategy_config.margin", "cannot be negative, got %v", *econConf.Margin)
+		}
+		e.Margin = *econConf.Margin
+	}
+	if econConf.Band != nil {
+		if *econConf.Band < 0 {
+			return nil, nil, utils.NewFieldError(conf.Path, "strategy_config.band", "cannot be negative, got %v", *econConf.Band)
+		}
+		e.Band = *econConf.Band
+	}
+	if econConf.Duty != nil {
+		if *econConf.Duty <= 0 || *econConf.Duty > 100 {
+			return nil, nil, utils.NewFieldError(conf.Path, "strategy_config.duty", "must be above 0 and at most 100, got %v", *econConf.Duty)
+		}
+		e.Duty = *econConf.Duty / 100
+	}
+	if e.MinOutdoorTemperature != nil && e.MaxOutdoorTemperature != nil && *e.MinOutdoorTemperature >= *e.MaxOutdoorTemperature {
+		return nil, nil, utils.NewFieldError(conf.Path, "strategy_config.min_outdoor_temperature", "must be less than max_outdoor_temperature %v, got %v", *e.MaxOutdoorTemperature, *e.MinOutdoorTemperature)
+	}
+	if e.MaxOutdoorHumidity != nil && (*e.MaxOutdoorHumidity <= 0 || *e.MaxOutdoorHumidity > 100) {
+		return nil, nil, utils.NewFieldError(conf.Path, "strategy_config.max_outdoor_humidity", "must be above 0 and at most 100, got %v", *e.MaxOutdoorHumidity)
+	}
+
+	// The humidities are only read when a humidity lockout needs them
+	if err := conf.RequireInput("strategy_config.outdoor_input", e.OutdoorInput); err != nil {
+		return nil, nil, err
+	}
+	if e.MaxOutdoorHumidity != nil || e.RequireDrier {
+		if err := conf.RequireInput("strategy_config.outdoor_humidity_input", e.OutdoorHumidityInput); err != nil {
+			return nil, nil, err
+		}
+	}
+	if e.RequireDrier {
+		if err := conf.RequireInput("strategy_config.indoor_humidity_input", e.IndoorHumidityInput); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// Carry on running through a reconfigure rather than dropping out and waiting for the margin again
+	if previous, ok := conf.Previous.(*Economizer); ok {
+		e.running = previous.running
+	}
+	return e, nil, nil
+}
+
+func (e *Economizer) measurement(in Input, name string, what string) (float64, error) {
+	m, ok := in.Measurements[name]
+	if !ok {
+		return 0, fmt.Errorf("economizer needs the %s from an input named %s", what, name)
+	}
+	return m.Value, nil
+}
+
+func (e *Economizer) Demand(in Input) (Output, error) {
+	indoor := in.Primary().Value
+	outdoor, err := e.measurement(in, e.OutdoorInput, "outdoor temperature")
+	if err != nil {
+		return Output{}, err
+	}
+	diagnostics := map[string]interface{}{
+		"outdoor_temperature":    outdoor,
+		"temperature_difference": indoor - outdoor,
+	}
+
+	lockout, err := e.lockout(in, indoor, outdoor, diagnostics)
+	if err != nil {
+		return Output{}, err
+	}
+	diagnostics["lockout_reason"] = lockout
+	if lockout != LockoutNone {
+		e.running = false
+		diagnostics["economizer_state"] = EconomizerLockedOut
+		return Output{Level: 0, Diagnostics: diagnostics}, nil
+	}
+
+	// Once running, the difference has to drop band below the margin before it stops
+	margin := e.Margin
+	if e.running {
+		margin -= e.Band
+	}
+	e.running = indoor-outdoor >= margin
+	if e.running {
+		diagnostics["economizer_state"] = EconomizerRunning
+		return Output{Level: e.Duty, Diagnostics: diagnostics}, nil
+	}
+	diagnostics["economizer_state"] = EconomizerIdle
+	return Output{Level: 0, Diagnostics: diagnostics}, nil
+}
+
+// lockout is why the outdoor air can't be used right now, or LockoutNone if it can
+func (e *Economizer) lockout(in Input, indoor float64, outdoor float64, diagnostics map[string]interface{}) (string, error) {
+	if e.MaxOutdoorTemperature != nil && outdoor > *e.MaxOutdoorTemperature {
+		return LockoutOutdoorHot, nil
+	}
+	if e.MinOutdoorTemperature != nil && outdoor < *e.MinOutdoorTemperature {
+		return LockoutOutdoorCold, nil
+	}
+	if e.MinIndoorTemperature != nil && indoor <= *e.MinIndoorTemperature {
+		return LockoutIndoorCool, nil
+	}
+	if e.MaxOutdoorHumidity == nil && !e.RequireDrier {
+		return LockoutNone, nil
+	}
+
+	outdoorRH, err := e.measurement(in, e.OutdoorHumidityInput, "outdoor humidity")
+	if err != nil {
+		return "", err
+	}
+	diagnostics["outdoor_humidity"] = outdoorRH
+	if e.MaxOutdoorHumidity != nil && outdoorRH > *e.MaxOutdoorHumidity {
+		return LockoutOutdoorHumid, nil
+	}
+	if !e.RequireDrier {
+		return LockoutNone, nil
+	}
+
+	// Relative humidity isn't comparable between different temperatures, the dew point is
+	indoorRH, err := e.measurement(in, e.IndoorHumidityInput, "indoor humidity")
+	if err != nil {
+		return "", err
+	}
+	indoorDew, err := dewPoint(indoor, indoorRH)
+	if err != nil {
+		return "", fmt.Errorf("error getting indoor dew point: %w", err)
+	}
+	outdoorDew, err := dewPoint(outdoor, outdoorRH)
+	if err != nil {
+		return "", fmt.Errorf("error getting outdoor dew point: %w", err)
+	}
+	diagnostics["indoor_dew_point"] = indoorDew
+	diagnostics["outdoor_dew_point"] = outdoorDew
+	if outdoorDew >= indoorDew {
+		return LockoutOutdoorWetter, nil
+	}
+	return LockoutNone, nil
+}
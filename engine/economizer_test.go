@@ -0,0 +1,107 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func economizerInput(indoor float64, values map[string]float64) Input {
+	measurements := map[string]Measurement{PrimaryInput: {Value: indoor}}
+	for name, value := range values {
+		measurements[name] = Measurement{Value: value}
+	}
+	return Input{Measurements: measurements}
+}
+
+func TestEconomizer(t *testing.T) {
+	strategy, _, err := NewStrategy(StrategyEconomizer, StrategyConfig{Path: "fan", Attributes: map[string]interface{}{
+		"margin":                  3,
+		"max_outdoor_temperature": 28,
+		"min_outdoor_temperature": 5,
+	}, Inputs: []string{PrimaryInput, "outdoor"}})
+	assert.NoError(t, err)
+
+	// Only 2 degrees cooler outside isn't worth it
+	output, err := strategy.Demand(economizerInput(30, map[string]float64{"outdoor": 28}))
+	assert.NoError(t, err)
+	assert.Equal(t, 0.0, output.Level)
+	assert.Equal(t, EconomizerIdle, output.Diagnostics["economizer_state"])
+	assert.Equal(t, LockoutNone, output.Diagnostics["lockout_reason"])
+
+	output, err = strategy.Demand(economizerInput(30, map[string]float64{"outdoor": 26}))
+	assert.NoError(t, err)
+	assert.Equal(t, 1.0, output.Level)
+	assert.Equal(t, EconomizerRunning, output.Diagnostics["economizer_state"])
+
+	// Once running, it keeps going until the difference drops a degree under the margin
+	output, err = strategy.Demand(economizerInput(28.5, map[string]float64{"outdoor": 26}))
+	assert.NoError(t, err)
+	assert.Equal(t, 1.0, output.Level)
+	output, err = strategy.Demand(economizerInput(27.5, map[string]float64{"outdoor": 26}))
+	assert.NoError(t, err)
+	assert.Equal(t, 0.0, output.Level)
+
+	// Outdoor air outside the limits is never used, however much cooler it is
+	output, err = strategy.Demand(economizerInput(40, map[string]float64{"outdoor": 30}))
+	assert.NoError(t, err)
+	assert.Equal(t, 0.0, output.Level)
+	assert.Equal(t, EconomizerLockedOut, output.Diagnostics["economizer_state"])
+	assert.Equal(t, LockoutOutdoorHot, output.Diagnostics["lockout_reason"])
+
+	output, err = strategy.Demand(economizerInput(20, map[string]float64{"outdoor": 0}))
+	assert.NoError(t, err)
+	assert.Equal(t, LockoutOutdoorCold, output.Diagnostics["lockout_reason"])
+
+	_, err = strategy.Demand(economizerInput(20, nil))
+	assert.ErrorContains(t, err, "outdoor")
+}
+
+func TestEconomizerHumidity(t *testing.T) {
+	strategy, _, err := NewStrategy(StrategyEconomizer, StrategyConfig{Path: "fan", Attributes: map[string]interface{}{
+		"max_outdoor_humidity": 90,
+		"require_drier":        true,
+	}, Inputs: []string{PrimaryInput, "outdoor", "outdoor_humidity", HumidityInput}})
+	assert.NoError(t, err)
+
+	// Cooler but muggy outside
+	output, err := strategy.Demand(economizerInput(30, map[string]float64{"outdoor": 22, "outdoor_humidity": 95, "humidity": 40}))
+	assert.NoError(t, err)
+	assert.Equal(t, LockoutOutdoorHumid, output.Diagnostics["lockout_reason"])
+
+	// 22C at 80% has a dew point of about 18.4C, 30C at 40% only about 14.9C
+	output, err = strategy.Demand(economizerInput(30, map[string]float64{"outdoor": 22, "outdoor_humidity": 80, "humidity": 40}))
+	assert.NoError(t, err)
+	assert.Equal(t, LockoutOutdoorWetter, output.Diagnostics["lockout_reason"])
+
+	output, err = strategy.Demand(economizerInput(30, map[string]float64{"outdoor": 22, "outdoor_humidity": 50, "humidity": 40}))
+	assert.NoError(t, err)
+	assert.Equal(t, EconomizerRunning, output.Diagnostics["economizer_state"])
+
+	_, err = strategy.Demand(economizerInput(30, map[string]float64{"outdoor": 22, "humidity": 40}))
+	assert.ErrorContains(t, err, "outdoor_humidity")
+}
+
+func TestEconomizerValidation(t *testing.T) {
+	_, _, err := NewStrategy(StrategyEconomizer, StrategyConfig{Path: "fan", Attributes: map[string]interface{}{"min_outdoor_temperature": 30, "max_outdoor_temperature": 20}})
+	assert.ErrorContains(t, err, "strategy_config.min_outdoor_temperature")
+
+	_, _, err = NewStrategy(StrategyEconomizer, StrategyConfig{Path: "fan", Attributes: map[string]interface{}{"margin": -1}})
+	assert.ErrorContains(t, err, "strategy_config.margin")
+
+	// Every input the economizer will read has to be configured
+	_, _, err = NewStrategy(StrategyEconomizer, StrategyConfig{Path: "fan", Attributes: map[string]interface{}{"outdoor_input": "weather"}, Inputs: []string{PrimaryInput, "outdoor"}})
+	assert.ErrorContains(t, err, "there is no input named weather")
+
+	_, _, err = NewStrategy(StrategyEconomizer, StrategyConfig{Path: "fan", Attributes: map[string]interface{}{"max_outdoor_humidity": 90}, Inputs: []string{PrimaryInput, "outdoor"}})
+	assert.ErrorContains(t, err, "strategy_config.outdoor_humidity_input")
+
+	_, _, err = NewStrategy(StrategyEconomizer, StrategyConfig{Path: "fan", Attributes: map[string]interface{}{"require_drier": true}, Inputs: []string{PrimaryInput, "outdoor", "outdoor_humidity"}})
+	assert.ErrorContains(t, err, "strategy_config.indoor_humidity_input")
+
+	_, _, err = NewStrategy(StrategyEconomizer, StrategyConfig{Path: "fan", Quantity: "co2", Inputs: []string{PrimaryInput, "outdoor"}})
+	assert.ErrorContains(t, err, "economizer needs the quantity to be temperature, got co2")
+
+	_, _, err = NewStrategy(StrategyEconomizer, StrategyConfig{Path: "fan", Quantity: "temperature", Inputs: []string{PrimaryInput, "outdoor"}})
+	assert.NoError(t, err)
+}
@@ -0,0 +1,533 @@
+// Package engine is the control loop shared by the fan models. A model only has to turn its config into a Strategy,
+// which decides how hard the fans should run, and an Actuator, which drives them. The engine does the rest: reading
+// the sensor, running and supervising the loop, claiming outputs, manual overrides, readings and closing.
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"sync"
+	"time"
+
+	"go.viam.com/rdk/components/sensor"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/resource"
+	viam_utils "go.viam.com/utils"
+
+	"github.com/rinzlerlabs/viam-fan-controller/utils"
+)
+
+// How long a SetPower call holds the fans before automatic control takes back over
+const defaultOverrideDuration = 5 * time.Minute
+
+// What the controlled measurement is called in readings, unless the config says otherwise
+const defaultQuantity = "temperature"
+
+// Keys the engine puts in every controller's readings, a quantity can't be called any of these
+var reservedReadings = []string{"strategy", "unit", "manual_override", "loop_healthy", "loop_restarts", HumidityInput}
+
+// Model is how a fan model plugs into the engine
+type Model struct {
+	PrettyName string
+	// Build turns the model's config into everything the engine runs. previous is what's running now, or nil the
+	// first time, so state like cycle counts can be carried over. Build must not change anything that's running,
+	// if it fails the controller carries on with previous.
+	Build func(ctx context.Context, deps resource.Dependencies, conf resource.Config, previous *Settings, logger logging.Logger) (*Settings, error)
+}
+
+// Settings is everything the engine runs for one version of a controller's config
+type Settings struct {
+	Sensor           sensor.Sensor
+	SensorValueField string
+	SensorValueRegex *regexp.Regexp
+	// What the sensor measures, e.g. temperature or co2, and its unit, for readings
+	Quantity         string
+	Unit             string
+	inputs           []input
+	humidity         *humidity
+	StrategyName     string
+	Strategy         Strategy
+	Actuator         Actuator
+	OnClose          utils.ClosePolicy
+	Loop             utils.LoopSettings
+	OverrideDuration time.Duration
+}
+
+// Common is the config every model shares
+type Common struct {
+	SensorName       string
+	SensorValueKey   string
+	SensorValueRegex string
+	Quantity         string
+	Unit             string
+	OnClose          string
+	OverrideDuration int64
+	Loop             utils.LoopConfig
+	Inputs           []InputConfig
+	Humidity         *HumidityConfig
+}
+
+// ValidateQuantity checks the name the controlled measurement is reported under
+func ValidateQuantity(path string, quantity string) error {
+	if slices.Contains(reservedReadings, quantity) {
+		return utils.NewFieldError(path, "quantity", "%s is already used in readings", quantity)
+	}
+	return nil
+}
+
+// NewSettings looks up the sensor and parses the shared config, the model fills in the strategy and actuator
+func NewSettings(deps resource.Dependencies, path string, common Common) (*Settings, error) {
+	tempSensor, err := sensor.FromDependencies(deps, common.SensorName)
+	if err != nil {
+		return nil, fmt.Errorf("error looking up sensor %s: %w", common.SensorName, err)
+	}
+
+	onClose, err := utils.ParseClosePolicy(path, "on_close", common.OnClose)
+	if err != nil {
+		return nil, err
+	}
+
+	loop, err := utils.ParseLoopSettings(path, common.Loop)
+	if err != nil {
+		return nil, err
+	}
+
+	inputs, err := newInputs(deps, common.Inputs)
+	if err != nil {
+		return nil, err
+	}
+
+	humidity, err := newHumidity(deps, common.Humidity)
+	if err != nil {
+		return nil, err
+	}
+
+	settings := &Settings{
+		Sensor:           tempSensor,
+		SensorValueField: common.SensorValueKey,
+		Quantity:         defaultQuantity,
+		Unit:             common.Unit,
+		inputs:           inputs,
+		humidity:         humidity,
+		OnClose:          onClose,
+		Loop:             loop,
+		OverrideDuration: defaultOverrideDuration,
+	}
+	// We might not always get a regex, some sensors just return a number that can be parsed
+	if common.SensorValueRegex != "" {
+		settings.SensorValueRegex = regexp.MustCompile(common.SensorValueRegex)
+	}
+	if common.Quantity != "" {
+		settings.Quantity = common.Quantity
+	}
+	if common.OverrideDuration > 0 {
+		settings.OverrideDuration = time.Duration(common.OverrideDuration * int64(time.Second))
+	}
+	return settings, nil
+}
+
+// Controller is a running fan controller, it's the sensor every model registers and sits behind the motor API too
+type Controller struct {
+	resource.Named
+	model         Model
+	mu            sync.RWMutex
+	logger        logging.Logger
+	cancelCtx     context.Context
+	cancelFunc    func()
+	monitor       func()
+	done          chan bool
+	wg            sync.WaitGroup
+	settings      *Settings
+	watchdog      utils.Watchdog
+	overrideLevel float64
+	overrideUntil time.Time
+	// What the strategy said about its last decision
+	diagnostics map[string]interface{}
+	// The name the outputs are claimed under, it follows the controller through a rename
+	owner string
+}
+
+// New starts a controller for model
+func New(ctx context.Context, deps resource.Dependencies, conf resource.Config, logger logging.Logger, model Model) (*Controller, error) {
+	logger.Infof("Starting %s %s", model.PrettyName, utils.Version)
+	cancelCtx, cancelFunc := context.WithCancel(context.Background())
+
+	c := &Controller{
+		Named:      conf.ResourceName().AsNamed(),
+		model:      model,
+		logger:     logger,
+		cancelCtx:  cancelCtx,
+		cancelFunc: cancelFunc,
+		done:       make(chan bool),
+	}
+
+	if err := c.Reconfigure(ctx, deps, conf); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *Controller) Reconfigure(ctx context.Context, deps resource.Dependencies, conf resource.Config) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.logger.Debugf("Reconfiguring %s", c.model.PrettyName)
+
+	settings, err := c.model.Build(ctx, deps, conf, c.settings, c.logger)
+	if err != nil {
+		c.logger.Errorf("Error configuring %s: %s", c.model.PrettyName, err)
+		return err
+	}
+
+	// A renamed controller takes its claims with it, otherwise they'd be left behind under the old name for good
+	owner := conf.ResourceName().String()
+	renamed := c.owner != "" && c.owner != owner
+	if renamed {
+		utils.RenameOwner(c.owner, owner)
+	}
+
+	// Make sure no other controller is already driving any of these fans
+	released, err := utils.ClaimOutputs(owner, settings.Actuator.Outputs())
+	if err != nil {
+		if renamed {
+			utils.RenameOwner(owner, c.owner)
+		}
+		c.logger.Errorf("Error claiming fans: %s", err)
+		return err
+	}
+
+	// Nothing can fail from here on, so the monitor only ever sees the old config or the new one
+	old := c.settings
+	c.Named = conf.ResourceName().AsNamed()
+	c.owner = owner
+	c.settings = settings
+	c.diagnostics = nil
+	c.watchdog.SetTimeout(settings.Loop.WatchdogTimeout)
+
+	// Anything this controller no longer drives gets switched off rather than left running
+	if old != nil && len(released) > 0 {
+		for _, output := range released {
+			c.logger.Infof("No longer driving %s, turning it off", output)
+		}
+		if err := old.Actuator.Stop(ctx, released); err != nil {
+			c.logger.Errorf("Error turning off released fans: %s", err)
+		}
+	}
+
+	if c.monitor == nil {
+		c.monitor = func() {
+			ctx := c.cancelCtx
+			defer c.wg.Done()
+			generation := c.watchdog.Join(time.Now())
+			backoff := utils.Backoff{}
+			errorLog := utils.ErrorLogger{Logger: c.logger}
+			for {
+				select {
+				case <-c.done:
+					return
+				default:
+				}
+
+				// Back off while passes keep failing, so a missing sensor doesn't get hammered ten times a second
+				err := c.tick(ctx)
+				errorLog.Log(time.Now(), err)
+				loop := c.loopSettings()
+				wait := backoff.Next(err, loop.PollInterval, loop.MaxBackoff)
+
+				if !c.watchdog.Beat(generation, time.Now(), wait) {
+					c.logger.Warnf("Control loop was replaced by the watchdog, exiting")
+					return
+				}
+
+				select {
+				case <-time.After(wait):
+					continue
+				case <-c.done:
+					return
+				}
+			}
+		}
+
+		c.wg.Add(2)
+		viam_utils.PanicCapturingGo(c.monitor)
+		viam_utils.PanicCapturingGo(c.watch)
+	}
+
+	return nil
+}
+
+// Settings is what the controller is running now
+func (c *Controller) Settings() *Settings {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.settings
+}
+
+// loopSettings is the current loop config, it can change under the monitor with a reconfigure
+func (c *Controller) loopSettings() utils.LoopSettings {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.settings.Loop
+}
+
+// watch restarts the monitor if it stops finishing passes, whether it's stuck or it panicked
+func (c *Controller) watch() {
+	defer c.wg.Done()
+	c.watchdog.Watch(c.cancelCtx, c.restartMonitor)
+}
+
+// restartMonitor sets the fans to the failsafe duty and starts a new control loop, a stuck loop exits if it ever wakes up
+func (c *Controller) restartMonitor() {
+	// A stuck pass holds the lock until it wakes up. Writing the fans from under it would race with whatever it's
+	// doing to them, and a new loop would only queue up behind it on the lock, so nothing is restarted until it lets
+	// go. The watchdog stays tripped and tries again on its next check.
+	if !utils.LockWithTimeout(&c.mu, time.Second) {
+		c.logger.Errorf("Control loop is stuck holding the fans, waiting for it to let go before restarting it")
+		return
+	}
+	c.logger.Errorf("Control loop has stopped responding, setting fans to failsafe and restarting it")
+	err := utils.RunWithTimeout(c.cancelCtx, utils.CloseTimeout, func(ctx context.Context) error {
+		// A write that hangs keeps the lock, the same as a stuck pass
+		defer c.mu.Unlock()
+		return c.settings.Actuator.Force(ctx, c.settings.Loop.FailsafeDuty)
+	})
+	if errors.Is(err, context.DeadlineExceeded) {
+		c.logger.Errorf("Timed out setting fans to failsafe, waiting for them before restarting the control loop")
+		return
+	}
+	if err != nil {
+		c.logger.Errorf("Error setting fans to failsafe: %s", err)
+	}
+
+	select {
+	case <-c.done:
+		return
+	default:
+	}
+	c.watchdog.Restarted(time.Now())
+	c.wg.Add(1)
+	viam_utils.PanicCapturingGo(c.monitor)
+}
+
+// tick runs one pass of the control loop. It holds the lock the whole way through, so a reconfigure
+// lands either before or after it, never part way through
+func (c *Controller) tick(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := c.settings
+	ctx, cancel := context.WithTimeout(ctx, s.Loop.OperationTimeout)
+	defer cancel()
+
+	// A manual override from the motor API takes priority over the strategy until it expires
+	if level, ok := c.activeOverrideLocked(); ok {
+		if err := s.Actuator.Force(ctx, level); err != nil {
+			return fmt.Errorf("error setting fan speed: %w", err)
+		}
+		return nil
+	}
+
+	readings, err := utils.ReadSensor(ctx, s.Sensor, s.Loop.OperationTimeout)
+	if err != nil {
+		return fmt.Errorf("error getting readings from sensor: %w", err)
+	}
+
+	currentTemp, err := utils.ParseCurrentTemperatureFromReadings(ctx, readings, s.SensorValueField, s.SensorValueRegex, c.logger)
+	if err != nil {
+		return fmt.Errorf("error parsing current %s: %w", s.Quantity, err)
+	}
+
+	state, err := s.Actuator.State(ctx)
+	if err != nil {
+		return fmt.Errorf("error getting fan state: %w", err)
+	}
+
+	now := time.Now()
+	measurements := map[string]Measurement{PrimaryInput: {Time: now, Value: currentTemp}}
+	for _, in := range s.inputs {
+		value, err := in.measure(ctx, s.Loop.OperationTimeout, c.logger)
+		if err != nil {
+			return err
+		}
+		measurements[in.name] = Measurement{Time: time.Now(), Value: value}
+	}
+	if s.humidity != nil {
+		value, err := s.humidity.input.measure(ctx, s.Loop.OperationTimeout, c.logger)
+		if err != nil {
+			return err
+		}
+		measurements[HumidityInput] = Measurement{Time: time.Now(), Value: value}
+	}
+
+	output, err := s.Strategy.Demand(Input{Time: now, Measurements: measurements, State: state})
+	if err != nil {
+		return fmt.Errorf("error getting desired speed: %w", err)
+	}
+	if s.humidity != nil {
+		if output, err = c.withHumidity(s.humidity, measurements, output); err != nil {
+			return err
+		}
+	}
+	c.diagnostics = output.Diagnostics
+
+	c.logger.Debugf("Current %s: %f, desired speed: %f", s.Quantity, currentTemp, output.Level)
+	if err := s.Actuator.Apply(ctx, now, output.Level); err != nil {
+		return fmt.Errorf("error setting fan speed: %w", err)
+	}
+	return nil
+}
+
+// withHumidity combines the strategy's thermal demand with the humidity demand, whichever asks for more wins
+func (c *Controller) withHumidity(h *humidity, measurements map[string]Measurement, thermal Output) (Output, error) {
+	level, humidityDiagnostics, err := h.demand(measurements)
+	if err != nil {
+		return Output{}, fmt.Errorf("error getting dew point: %w", err)
+	}
+
+	diagnostics := make(map[string]interface{}, len(thermal.Diagnostics)+len(humidityDiagnostics)+1)
+	for key, value := range thermal.Diagnostics {
+		diagnostics[key] = value
+	}
+	for key, value := range humidityDiagnostics {
+		diagnostics[key] = value
+	}
+	switch {
+	case level > thermal.Level:
+		diagnostics["driving_demand"] = DemandHumidity
+	case thermal.Level > 0:
+		diagnostics["driving_demand"] = DemandThermal
+		level = thermal.Level
+	default:
+		diagnostics["driving_demand"] = DemandNone
+		level = thermal.Level
+	}
+	return Output{Level: level, Diagnostics: diagnostics}, nil
+}
+
+func (c *Controller) Readings(ctx context.Context, extra map[string]interface{}) (map[string]interface{}, error) {
+	// The sensors are read without the lock, a slow or hung sensor mustn't hold up the loop, or other readers
+	// queued behind it
+	s := c.Settings()
+	readings, err := utils.ReadSensor(ctx, s.Sensor, s.Loop.OperationTimeout)
+	if err != nil {
+		c.logger.Errorf("Error getting readings from sensor: %s", err)
+		return nil, err
+	}
+
+	currentTemp, err := utils.ParseCurrentTemperatureFromReadings(ctx, readings, s.SensorValueField, s.SensorValueRegex, c.logger)
+	if err != nil {
+		c.logger.Errorf("Error parsing current %s: %s", s.Quantity, err)
+		return nil, err
+	}
+
+	inputs := make(map[string]float64, len(s.inputs))
+	for _, in := range s.inputs {
+		value, err := in.measure(ctx, s.Loop.OperationTimeout, c.logger)
+		if err != nil {
+			c.logger.Errorf("Error reading input: %s", err)
+			return nil, err
+		}
+		inputs[in.name] = value
+	}
+
+	// The fans are only ever touched with the lock held. A reconfigure may have swapped them since the sensors were
+	// read, the readings are from whichever fans are there now.
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	result, err := c.settings.Actuator.Readings(ctx)
+	if err != nil {
+		c.logger.Errorf("Error getting fan speed: %s", err)
+		return nil, err
+	}
+
+	for name, value := range inputs {
+		result[name] = value
+	}
+
+	for key, value := range c.diagnostics {
+		result[key] = value
+	}
+
+	_, isOverridden := c.activeOverrideLocked()
+	healthy, restarts := c.watchdog.Health(time.Now())
+	result["strategy"] = c.settings.StrategyName
+	result[s.Quantity] = currentTemp
+	if s.Unit != "" {
+		result["unit"] = s.Unit
+	}
+	result["manual_override"] = isOverridden
+	result["loop_healthy"] = healthy
+	result["loop_restarts"] = restarts
+	return result, nil
+}
+
+// DoCommand passes commands on to the strategy, if it takes any
+func (c *Controller) DoCommand(ctx context.Context, cmd map[string]interface{}) (map[string]interface{}, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	commander, ok := c.settings.Strategy.(Commander)
+	if !ok {
+		return nil, resource.ErrDoUnimplemented
+	}
+	return commander.DoCommand(ctx, cmd)
+}
+
+func (c *Controller) Close(ctx context.Context) error {
+	c.logger.Infof("Shutting down %s", c.model.PrettyName)
+	close(c.done)
+	c.cancelFunc()
+	c.logger.Infof("Notifying monitor to shut down")
+	if err := utils.WaitContext(ctx, &c.wg); err != nil {
+		c.logger.Errorf("Error waiting for monitor to shut down: %s", err)
+	} else {
+		c.logger.Info("Monitor shut down")
+	}
+
+	err := c.applyClosePolicy(ctx)
+	c.closeActuator(ctx)
+	utils.ReleaseOutputs(c.owner)
+	return err
+}
+
+// closeActuator lets the actuator finish up. If the monitor never let go of the lock we'd rather lose whatever it
+// had to save than hang shutdown.
+func (c *Controller) closeActuator(ctx context.Context) {
+	if !c.mu.TryLock() {
+		c.logger.Warnf("Control loop is still holding the fans, unable to close them cleanly")
+		return
+	}
+	defer c.mu.Unlock()
+	closer, ok := c.settings.Actuator.(Closer)
+	if !ok {
+		return
+	}
+	if err := closer.Close(ctx); err != nil {
+		c.logger.Errorf("Error closing fans: %s", err)
+	}
+}
+
+// applyClosePolicy leaves the fans however on_close says, it gives up rather than hold up shutdown if the pins don't respond
+func (c *Controller) applyClosePolicy(ctx context.Context) error {
+	return utils.RunWithTimeout(ctx, utils.CloseTimeout, func(ctx context.Context) error {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		onClose := c.settings.OnClose
+		if onClose.Leaves() {
+			return nil
+		}
+
+		c.logger.Infof("Setting fans to %s on close", onClose)
+		if err := c.settings.Actuator.Force(ctx, onClose.Duty); err != nil {
+			c.logger.Errorf("Error setting fans to %s on close: %s", onClose, err)
+			return err
+		}
+		return nil
+	})
+}
+
+// Ready is whether the control loop is running and keeping up
+func (c *Controller) Ready(ctx context.Context, extra map[string]interface{}) (bool, error) {
+	healthy, _ := c.watchdog.Health(time.Now())
+	return healthy, nil
+}
@@ -0,0 +1,504 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.viam.com/rdk/components/sensor"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/resource"
+
+	"github.com/rinzlerlabs/viam-fan-controller/utils"
+)
+
+type fakeActuator struct {
+	mu      sync.Mutex
+	outputs []utils.Output
+	level   float64
+	stopped []utils.Output
+	// When set, Force hangs until it's closed, like a pin on a board that stopped responding
+	hang chan struct{}
+	// When set, State panics, like a buggy board driver
+	broken bool
+	// When set, Force fails without changing anything
+	refuse bool
+	closed bool
+}
+
+func (a *fakeActuator) Apply(ctx context.Context, now time.Time, level float64) error {
+	return a.Force(ctx, level)
+}
+
+func (a *fakeActuator) Force(ctx context.Context, level float64) error {
+	if a.hang != nil {
+		<-a.hang
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.refuse {
+		return errors.New("pin refused")
+	}
+	a.level = level
+	return nil
+}
+
+func (a *fakeActuator) State(ctx context.Context) (State, error) {
+	if a.broken {
+		panic("pin exploded")
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return State{Level: a.level}, nil
+}
+
+func (a *fakeActuator) Outputs() []utils.Output {
+	return a.outputs
+}
+
+func (a *fakeActuator) Stop(ctx context.Context, outputs []utils.Output) error {
+	a.stopped = append(a.stopped, outputs...)
+	return nil
+}
+
+func (a *fakeActuator) Readings(ctx context.Context) (map[string]interface{}, error) {
+	return map[string]interface{}{"level": a.Level()}, nil
+}
+
+func (a *fakeActuator) Close(ctx context.Context) error {
+	a.closed = true
+	return nil
+}
+
+func (a *fakeActuator) Level() float64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.level
+}
+
+// fakeStrategy always asks for the same level
+type fakeStrategy struct {
+	level float64
+}
+
+func (s *fakeStrategy) Demand(in Input) (Output, error) {
+	return Output{Level: s.level, Diagnostics: map[string]interface{}{"seen": in.Primary().Value}}, nil
+}
+
+type fakeSensor struct {
+	sensor.Sensor
+	temp float64
+	// When set, Readings hangs until it's closed, like a sensor on a bus that locked up
+	hang chan struct{}
+}
+
+func (s *fakeSensor) Readings(ctx context.Context, extra map[string]interface{}) (map[string]interface{}, error) {
+	if s.hang != nil {
+		<-s.hang
+	}
+	return map[string]interface{}{"temp": s.temp}, nil
+}
+
+// testConfig hands the test's actuator straight to the engine
+type testConfig struct {
+	actuator         *fakeActuator
+	demand           float64
+	onClose          string
+	operationTimeout int64
+	watchdogTimeout  int64
+	fail             bool
+	humidity         *HumidityConfig
+	quantity         string
+	unit             string
+}
+
+func (conf *testConfig) Validate(path string) ([]string, error) {
+	return []string{"sensor"}, nil
+}
+
+var testModel = Model{
+	PrettyName: "Test Fan Controller",
+	Build: func(ctx context.Context, deps resource.Dependencies, conf resource.Config, previous *Settings, logger logging.Logger) (*Settings, error) {
+		testConf := conf.ConvertedAttributes.(*testConfig)
+		if testConf.fail {
+			return nil, errors.New("bad config")
+		}
+		settings, err := NewSettings(deps, "fan", Common{
+			SensorName:     "sensor",
+			SensorValueKey: "temp",
+			OnClose:        testConf.onClose,
+			Loop:           utils.LoopConfig{OperationTimeout: testConf.operationTimeout, WatchdogTimeout: testConf.watchdogTimeout},
+			Humidity:       testConf.humidity,
+			Quantity:       testConf.quantity,
+			Unit:           testConf.unit,
+		})
+		if err != nil {
+			return nil, err
+		}
+		settings.StrategyName = "fake"
+		settings.Strategy = &fakeStrategy{level: testConf.demand}
+		settings.Actuator = testConf.actuator
+		return settings, nil
+	},
+}
+
+func testDeps() resource.Dependencies {
+	return resource.Dependencies{
+		sensor.Named("sensor"):   &fakeSensor{temp: 20},
+		sensor.Named("humidity"): &fakeSensor{temp: 90},
+	}
+}
+
+func testResourceConfig(conf *testConfig) resource.Config {
+	return resource.Config{Name: "fan", API: sensor.API, ConvertedAttributes: conf}
+}
+
+// newTestController builds a controller without starting the monitor, so the test drives every tick
+func newTestController(t *testing.T, conf *testConfig) *Controller {
+	cancelCtx, cancelFunc := context.WithCancel(context.Background())
+	c := &Controller{model: testModel, logger: logging.NewTestLogger(t), cancelCtx: cancelCtx, cancelFunc: cancelFunc, done: make(chan bool), monitor: func() {}}
+	assert.NoError(t, c.Reconfigure(context.Background(), testDeps(), testResourceConfig(conf)))
+	t.Cleanup(func() { utils.ReleaseOutputs(c.Name().String()) })
+	return c
+}
+
+func TestReconfigureStopsReleasedOutputs(t *testing.T) {
+	ctx := context.Background()
+	x, y, z := utils.GPIOOutput("pi", "11"), utils.GPIOOutput("pi", "13"), utils.GPIOOutput("pi", "15")
+	first := &fakeActuator{outputs: []utils.Output{x, y}}
+	c := newTestController(t, &testConfig{actuator: first})
+
+	// Only what the new config dropped gets turned off
+	second := &fakeActuator{outputs: []utils.Output{y, z}}
+	assert.NoError(t, c.Reconfigure(ctx, testDeps(), testResourceConfig(&testConfig{actuator: second})))
+	assert.Equal(t, []utils.Output{x}, first.stopped)
+	assert.Equal(t, second, c.Settings().Actuator)
+
+	// A failed reconfigure leaves the running config alone
+	assert.Error(t, c.Reconfigure(ctx, testDeps(), testResourceConfig(&testConfig{actuator: first, fail: true})))
+	assert.Equal(t, second, c.Settings().Actuator)
+
+	// So does one that wants an output another controller is driving
+	_, err := utils.ClaimOutputs("other", []utils.Output{x})
+	assert.NoError(t, err)
+	defer utils.ReleaseOutputs("other")
+	assert.Error(t, c.Reconfigure(ctx, testDeps(), testResourceConfig(&testConfig{actuator: first})))
+	assert.Equal(t, second, c.Settings().Actuator)
+	assert.Empty(t, second.stopped)
+}
+
+func TestReconfigureRenameMovesClaims(t *testing.T) {
+	ctx := context.Background()
+	x := utils.GPIOOutput("pi", "11")
+	actuator := &fakeActuator{outputs: []utils.Output{x}}
+	c := newTestController(t, &testConfig{actuator: actuator})
+	oldName := c.Name().String()
+
+	renamed := testResourceConfig(&testConfig{actuator: actuator})
+	renamed.Name = "renamed"
+	assert.NoError(t, c.Reconfigure(ctx, testDeps(), renamed))
+	assert.Empty(t, actuator.stopped)
+
+	// Still ours under the new name, and a new controller with the old name can't take it
+	_, err := utils.ClaimOutputs(oldName, []utils.Output{x})
+	assert.ErrorContains(t, err, "renamed")
+
+	// Closing gives up the claims under the name they're held under
+	assert.NoError(t, c.Close(ctx))
+	_, err = utils.ClaimOutputs("other", []utils.Output{x})
+	assert.NoError(t, err)
+	utils.ReleaseOutputs("other")
+}
+
+func TestTickFollowsStrategy(t *testing.T) {
+	ctx := context.Background()
+	actuator := &fakeActuator{}
+	c := newTestController(t, &testConfig{actuator: actuator, demand: 0.6})
+
+	assert.NoError(t, c.tick(ctx))
+	assert.Equal(t, 0.6, actuator.Level())
+
+	// A manual override wins until it's cleared
+	c.mu.Lock()
+	c.setOverrideLocked(0.2)
+	c.mu.Unlock()
+	assert.NoError(t, c.tick(ctx))
+	assert.Equal(t, 0.2, actuator.Level())
+	c.clearOverride()
+	assert.NoError(t, c.tick(ctx))
+	assert.Equal(t, 0.6, actuator.Level())
+
+	readings, err := c.Readings(ctx, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 20.0, readings["temperature"])
+	assert.Equal(t, 0.6, readings["level"])
+	assert.Equal(t, "fake", readings["strategy"])
+	assert.Equal(t, 20.0, readings["seen"])
+	assert.Equal(t, false, readings["manual_override"])
+}
+
+func TestTickCombinesHumidity(t *testing.T) {
+	ctx := context.Background()
+	actuator := &fakeActuator{}
+	maxHumidity, duty := 80.0, 70.0
+	humidity := &HumidityConfig{SensorName: "humidity", SensorValueKey: "temp", MaxHumidity: &maxHumidity, Duty: &duty}
+	c := newTestController(t, &testConfig{actuator: actuator, demand: 0.5, humidity: humidity})
+
+	// 90% is over the limit and asks for more than the strategy does
+	assert.NoError(t, c.tick(ctx))
+	assert.Equal(t, 0.7, actuator.Level())
+	readings, err := c.Readings(ctx, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 90.0, readings["humidity"])
+	assert.InDelta(t, 18.3, readings["dew_point"], 0.1)
+	assert.Equal(t, DemandHumidity, readings["driving_demand"])
+
+	// The strategy wins when it asks for more
+	c.settings.Strategy = &fakeStrategy{level: 0.9}
+	assert.NoError(t, c.tick(ctx))
+	assert.Equal(t, 0.9, actuator.Level())
+	assert.Equal(t, DemandThermal, c.diagnostics["driving_demand"])
+	assert.Equal(t, 20.0, c.diagnostics["seen"])
+}
+
+func TestReadingsUseQuantity(t *testing.T) {
+	c := newTestController(t, &testConfig{actuator: &fakeActuator{}, quantity: "co2", unit: "ppm"})
+	readings, err := c.Readings(context.Background(), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 20.0, readings["co2"])
+	assert.Equal(t, "ppm", readings["unit"])
+	assert.NotContains(t, readings, "temperature")
+
+	assert.ErrorContains(t, ValidateQuantity("fan", "loop_healthy"), "quantity")
+	assert.NoError(t, ValidateQuantity("fan", "pressure"))
+}
+
+func TestValidateInputs(t *testing.T) {
+	input := func(name string) []InputConfig {
+		return []InputConfig{{Name: name, SensorName: "other", SensorValueKey: "value"}}
+	}
+	deps, err := ValidateInputs("fan", input("load"), "")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"other"}, deps)
+
+	tests := []struct {
+		name     string
+		inputs   []InputConfig
+		quantity string
+		err      string
+	}{
+		{"no name", input(""), "", "inputs[0].name"},
+		{"duplicate", append(input("load"), input("load")...), "", "inputs[1].name"},
+		{"primary", input(PrimaryInput), "", "primary is already in use"},
+		{"strategy", input("strategy"), "", "strategy is already in use"},
+		{"unit", input("unit"), "", "unit is already in use"},
+		{"manual override", input("manual_override"), "", "manual_override is already in use"},
+		{"loop healthy", input("loop_healthy"), "", "loop_healthy is already in use"},
+		{"loop restarts", input("loop_restarts"), "", "loop_restarts is already in use"},
+		{"humidity", input("humidity"), "", "humidity is already in use"},
+		{"default quantity", input("temperature"), "", "temperature is already in use"},
+		{"quantity", input("co2"), "co2", "co2 is already in use"},
+		{"fuzzy value", input("value"), "co2", "value is already in use"},
+		{"fuzzy rate", input("rate"), "", "rate is already in use"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ValidateInputs("fan", tt.inputs, tt.quantity)
+			assert.ErrorContains(t, err, tt.err)
+		})
+	}
+}
+
+func TestDoCommandNeedsCommander(t *testing.T) {
+	c := newTestController(t, &testConfig{actuator: &fakeActuator{}})
+	_, err := c.DoCommand(context.Background(), map[string]interface{}{"command": CommandExportTable})
+	assert.ErrorIs(t, err, resource.ErrDoUnimplemented)
+}
+
+func TestOverride(t *testing.T) {
+	c := &Controller{settings: &Settings{OverrideDuration: 50 * time.Millisecond}}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// No override until someone asks for one
+	_, ok := c.activeOverrideLocked()
+	assert.False(t, ok)
+
+	c.setOverrideLocked(0.4)
+	speed, ok := c.activeOverrideLocked()
+	assert.True(t, ok)
+	assert.Equal(t, 0.4, speed)
+
+	// Overrides expire on their own
+	time.Sleep(100 * time.Millisecond)
+	_, ok = c.activeOverrideLocked()
+	assert.False(t, ok)
+
+	// Or can be cleared early
+	c.setOverrideLocked(1)
+	c.clearOverrideLocked()
+	_, ok = c.activeOverrideLocked()
+	assert.False(t, ok)
+}
+
+func TestSetPowerOverride(t *testing.T) {
+	ctx := context.Background()
+	actuator := &fakeActuator{}
+	m := &fanMotor{Controller: newTestController(t, &testConfig{actuator: actuator})}
+
+	assert.NoError(t, m.SetPower(ctx, -0.5, nil))
+	assert.Equal(t, 0.5, actuator.Level())
+	m.mu.RLock()
+	level, ok := m.activeOverrideLocked()
+	m.mu.RUnlock()
+	assert.True(t, ok)
+	assert.Equal(t, 0.5, level)
+
+	// If the fans can't be set the override is dropped, the strategy carries on driving them
+	assert.NoError(t, m.Stop(ctx, nil))
+	actuator.refuse = true
+	assert.Error(t, m.SetPower(ctx, 1, nil))
+	m.mu.RLock()
+	_, ok = m.activeOverrideLocked()
+	m.mu.RUnlock()
+	assert.False(t, ok)
+	assert.Equal(t, 0.5, actuator.Level())
+}
+
+func TestCloseAppliesPolicy(t *testing.T) {
+	ctx := context.Background()
+	for _, tc := range []struct {
+		onClose   string
+		wasLevel  float64
+		wantLevel float64
+	}{
+		{"", 0.7, 0.7},
+		{"leave", 0, 0},
+		{"off", 0.7, 0},
+		{"full_speed", 0, 1},
+		{"fixed:40", 0, 0.4},
+		{"fixed:0", 0.7, 0},
+	} {
+		actuator := &fakeActuator{outputs: []utils.Output{utils.GPIOOutput("pi", "11")}, level: tc.wasLevel}
+		c := newTestController(t, &testConfig{actuator: actuator, onClose: tc.onClose})
+
+		assert.NoError(t, c.Close(ctx), tc.onClose)
+		assert.Equal(t, tc.wantLevel, actuator.Level(), tc.onClose)
+		// The fans get closed after the policy is applied, whatever it is
+		assert.True(t, actuator.closed, tc.onClose)
+	}
+}
+
+func TestCloseStopsMonitor(t *testing.T) {
+	actuator := &fakeActuator{outputs: []utils.Output{utils.GPIOOutput("pi", "11")}}
+
+	// This runs the real monitor, Close used to block forever on it
+	c, err := New(context.Background(), testDeps(), testResourceConfig(&testConfig{actuator: actuator, onClose: "full_speed"}), logging.NewTestLogger(t), testModel)
+	assert.NoError(t, err)
+	time.Sleep(250 * time.Millisecond)
+	assert.NoError(t, c.Close(context.Background()))
+	assert.Equal(t, 1.0, actuator.Level())
+
+	// The claim goes with it
+	_, err = utils.ClaimOutputs("other", []utils.Output{utils.GPIOOutput("pi", "11")})
+	assert.NoError(t, err)
+	utils.ReleaseOutputs("other")
+}
+
+func TestCloseHonorsDeadline(t *testing.T) {
+	actuator := &fakeActuator{}
+	c := newTestController(t, &testConfig{actuator: actuator, onClose: "off"})
+	actuator.hang = make(chan struct{})
+	defer close(actuator.hang)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	assert.Error(t, c.Close(ctx))
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestWatchdogRestartsDeadLoop(t *testing.T) {
+	actuator := &fakeActuator{broken: true}
+
+	// Every pass panics, so the loop dies straight away and the watchdog has to notice
+	c, err := New(context.Background(), testDeps(), testResourceConfig(&testConfig{actuator: actuator, operationTimeout: 1, watchdogTimeout: 2}), logging.NewTestLogger(t), testModel)
+	assert.NoError(t, err)
+	defer c.Close(context.Background())
+
+	assert.Eventually(t, func() bool {
+		_, restarts := c.watchdog.Health(time.Now())
+		return restarts > 0
+	}, 5*time.Second, 100*time.Millisecond)
+
+	// The failsafe defaults to full speed
+	assert.Equal(t, 1.0, actuator.Level())
+	ready, err := c.Ready(context.Background(), nil)
+	assert.NoError(t, err)
+	assert.False(t, ready)
+}
+
+func TestFailsafeWaitsForLock(t *testing.T) {
+	actuator := &fakeActuator{level: 0.3}
+	c := newTestController(t, &testConfig{actuator: actuator})
+
+	// A stuck pass still has the fans, the failsafe mustn't write them out from under it or start a loop behind it
+	c.mu.Lock()
+	c.restartMonitor()
+	c.mu.Unlock()
+	assert.Equal(t, 0.3, actuator.Level())
+	_, restarts := c.watchdog.Health(time.Now())
+	assert.Equal(t, 0, restarts)
+
+	c.restartMonitor()
+	assert.Equal(t, 1.0, actuator.Level())
+	_, restarts = c.watchdog.Health(time.Now())
+	assert.Equal(t, 1, restarts)
+}
+
+func TestWatchdogWaitsForStuckPass(t *testing.T) {
+	actuator := &fakeActuator{hang: make(chan struct{})}
+
+	// The first pass hangs writing the fans and never lets go of the lock
+	c, err := New(context.Background(), testDeps(), testResourceConfig(&testConfig{actuator: actuator, operationTimeout: 1, watchdogTimeout: 2}), logging.NewTestLogger(t), testModel)
+	assert.NoError(t, err)
+
+	// Well past the timeout the loop is unhealthy, but no more loops have been started to pile up behind it
+	time.Sleep(3500 * time.Millisecond)
+	healthy, restarts := c.watchdog.Health(time.Now())
+	assert.False(t, healthy)
+	assert.Equal(t, 0, restarts)
+
+	// Once the pass lets go the same loop carries on
+	close(actuator.hang)
+	assert.Eventually(t, func() bool {
+		healthy, _ := c.watchdog.Health(time.Now())
+		return healthy
+	}, 5*time.Second, 100*time.Millisecond)
+	assert.NoError(t, c.Close(context.Background()))
+}
+
+func TestReadingsTimesOutHungSensor(t *testing.T) {
+	c := newTestController(t, &testConfig{actuator: &fakeActuator{}, operationTimeout: 1})
+	hung := &fakeSensor{hang: make(chan struct{})}
+	defer close(hung.hang)
+	c.settings.Sensor = hung
+
+	// The loop can still take the lock while the sensor is hung
+	start := time.Now()
+	result := make(chan error, 1)
+	go func() {
+		_, err := c.Readings(context.Background(), nil)
+		result <- err
+	}()
+	time.Sleep(100 * time.Millisecond)
+	assert.True(t, c.mu.TryLock())
+	c.mu.Unlock()
+
+	// And Readings gives up after operation_timeout
+	assert.Error(t, <-result)
+	assert.Less(t, time.Since(start), 2*time.Second)
+}
@@ -0,0 +1,175 @@
+package engine
+
+import (
+	"math"
+	"time"
+)
+
+// The fewest samples a fit is tried with, fewer than this and noise dominates
+const minFitSamples = 20
+
+// plantSample is the temperature and fan level at one point in the recorded history
+type plantSample struct {
+	Time        time.Time
+	Temperature float64
+	Level       float64
+}
+
+// plantModel is a first order plus dead time model of how the temperature responds to the fans:
+//
+//	tau * dT/dt = -(T - Ambient) + Gain * level(t - DeadTime)
+//
+// Gain is how far running the fans flat out moves the temperature once it settles, negative when they cool.
+// Ambient is where the temperature settles with the fans off.
+type plantModel struct {
+	Gain         float64
+	TimeConstant time.Duration
+	DeadTime     time.Duration
+	Ambient      float64
+	// The root mean square error of the fit's one step predictions
+	RMSE     float64
+	Samples  int
+	FittedAt time.Time
+	// The discrete form, T[k+1] = a*T[k] + b*level[k-delay] + c, with samples period apart
+	a, b, c float64
+	delay   int
+	period  time.Duration
+}
+
+// plantHistory records the temperature and fan level every period, and fits a plantModel to it
+type plantHistory struct {
+	period      time.Duration
+	size        int
+	maxDelay    int
+	samples     []plantSample
+	model       *plantModel
+	lastFitTime time.Time
+}
+
+func (h *plantHistory) record(now time.Time, temperature float64, level float64) {
+	if n := len(h.samples); n > 0 && now.Sub(h.samples[n-1].Time) < h.period {
+		return
+	}
+	h.samples = append(h.samples, plantSample{Time: now, Temperature: temperature, Level: level})
+	if len(h.samples) > h.size {
+		h.samples = h.samples[len(h.samples)-h.size:]
+	}
+}
+
+// fit finds the model that best predicts each sample from the one before it, trying every dead time up to
+// maxDelay. The model is only replaced if the fit makes physical sense, so a stretch of data with nothing going
+// on doesn't throw away a good model.
+func (h *plantHistory) fit(now time.Time) *plantModel {
+	h.lastFitTime = now
+	var best *plantModel
+	for delay := 0; delay <= h.maxDelay; delay++ {
+		model := fitDelay(h.samples, delay, h.period)
+		if model != nil && (best == nil || model.RMSE < best.RMSE) {
+			best = model
+		}
+	}
+	if best != nil {
+		best.FittedAt = now
+		h.model = best
+	}
+	return best
+}
+
+// fitDelay is the least squares fit of T[k+1] = a*T[k] + b*level[k-delay] + c
+func fitDelay(samples []plantSample, delay int, period time.Duration) *plantModel {
+	n := len(samples) - 1 - delay
+	if n < minFitSamples {
+		return nil
+	}
+
+	var xtx [3][3]float64
+	var xty [3]float64
+	for k := delay; k < len(samples)-1; k++ {
+		x := [3]float64{samples[k].Temperature, samples[k-delay].Level, 1}
+		y := samples[k+1].Temperature
+		for i := range x {
+			for j := range x {
+				xtx[i][j] += x[i] * x[j]
+			}
+			xty[i] += x[i] * y
+		}
+	}
+	coefficients, ok := solve3(xtx, xty)
+	if !ok {
+		return nil
+	}
+	a, b, c := coefficients[0], coefficients[1], coefficients[2]
+	// Anything outside this either grows without bound or oscillates, neither is a thermal response
+	if a <= 0 || a >= 1 {
+		return nil
+	}
+
+	var sse float64
+	for k := delay; k < len(samples)-1; k++ {
+		predicted := a*samples[k].Temperature + b*samples[k-delay].Level + c
+		sse += math.Pow(samples[k+1].Temperature-predicted, 2)
+	}
+
+	return &plantModel{
+		Gain:         b / (1 - a),
+		TimeConstant: time.Duration(-period.Seconds() / math.Log(a) * float64(time.Second)),
+		DeadTime:     time.Duration(delay) * period,
+		Ambient:      c / (1 - a),
+		RMSE:         math.Sqrt(sse / float64(n)),
+		Samples:      n,
+		a:            a,
+		b:            b,
+		c:            c,
+		delay:        delay,
+		period:       period,
+	}
+}
+
+// solve3 solves a 3x3 system by Gaussian elimination with partial pivoting, false if it's singular
+func solve3(m [3][3]float64, v [3]float64) ([3]float64, bool) {
+	for col := 0; col < 3; col++ {
+		pivot := col
+		for row := col + 1; row < 3; row++ {
+			if math.Abs(m[row][col]) > math.Abs(m[pivot][col]) {
+				pivot = row
+			}
+		}
+		if math.Abs(m[pivot][col]) < 1e-9 {
+			return [3]float64{}, false
+		}
+		m[col], m[pivot] = m[pivot], m[col]
+		v[col], v[pivot] = v[pivot], v[col]
+		for row := col + 1; row < 3; row++ {
+			factor := m[row][col] / m[col][col]
+			for j := col; j < 3; j++ {
+				m[row][j] -= factor * m[col][j]
+			}
+			v[row] -= factor * v[col]
+		}
+	}
+
+	var x [3]float64
+	for row := 2; row >= 0; row-- {
+		sum := v[row]
+		for j := row + 1; j < 3; j++ {
+			sum -= m[row][j] * x[j]
+		}
+		x[row] = sum / m[row][row]
+	}
+	return x, true
+}
+
+// predict is the temperature horizon from now, starting at temperature. The levels already on their way through
+// the dead time come from the history, after that the fans are assumed to stay at level.
+func (m *plantModel) predict(history []plantSample, temperature float64, level float64, horizon time.Duration) float64 {
+	steps := int(math.Ceil(horizon.Seconds() / m.period.Seconds()))
+	latest := len(history) - 1
+	for step := 0; step < steps; step++ {
+		input := level
+		if i := latest + step - m.delay; i >= 0 && i < latest {
+			input = history[i].Level
+		}
+		temperature = m.a*temperature + m.b*input + m.c
+	}
+	return temperature
+}
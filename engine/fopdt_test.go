@@ -0,0 +1,112 @@
+package engine
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// simulatePlant runs an enclosure that settles at 50 with the fans off and 30 with them flat out, with a 5 minute
+// time constant and 15 seconds of dead time, while the fans switch on and off every 5 minutes
+func simulatePlant(start time.Time, count int) []plantSample {
+	period := 5 * time.Second
+	a := math.Exp(-period.Seconds() / 300)
+	samples := make([]plantSample, 0, count)
+	temperature := 50.0
+	for k := 0; k < count; k++ {
+		level := float64((k / 60) % 2)
+		samples = append(samples, plantSample{Time: start.Add(time.Duration(k) * period), Temperature: temperature, Level: level})
+		delayed := 0.0
+		if k >= 3 {
+			delayed = float64(((k - 3) / 60) % 2)
+		}
+		temperature = a*temperature + (1-a)*(50-20*delayed)
+	}
+	return samples
+}
+
+func TestFitPlantModel(t *testing.T) {
+	now := time.Now()
+	history := &plantHistory{period: 5 * time.Second, size: 720, maxDelay: 12, samples: simulatePlant(now, 480)}
+	model := history.fit(now)
+	assert.NotNil(t, model)
+	assert.InDelta(t, -20, model.Gain, 0.01)
+	assert.InDelta(t, 300, model.TimeConstant.Seconds(), 0.5)
+	assert.Equal(t, 15*time.Second, model.DeadTime)
+	assert.InDelta(t, 50, model.Ambient, 0.01)
+
+	// Nothing changing means nothing to learn from, and the old model is kept
+	flat := &plantHistory{period: 5 * time.Second, size: 720, maxDelay: 12, model: model}
+	for k := 0; k < 100; k++ {
+		flat.record(now.Add(time.Duration(k)*5*time.Second), 40, 0.5)
+	}
+	assert.Nil(t, flat.fit(now))
+	assert.Equal(t, model, flat.model)
+}
+
+func TestPlantModelPredicts(t *testing.T) {
+	now := time.Now()
+	samples := simulatePlant(now, 480)
+	history := &plantHistory{period: 5 * time.Second, size: 720, maxDelay: 12, samples: samples}
+	model := history.fit(now)
+
+	// After a full time constant at full speed, the temperature has gone about 63% of the way to 30
+	latest := samples[len(samples)-1]
+	predicted := model.predict(samples, latest.Temperature, 1, 300*time.Second+model.DeadTime)
+	expected := 30 + (latest.Temperature-30)*math.Exp(-1)
+	assert.InDelta(t, expected, predicted, 0.5)
+}
+
+func TestPredictiveStrategy(t *testing.T) {
+	attributes := map[string]interface{}{
+		"horizon":           300,
+		"temperature_table": map[string]float64{"0": 0, "40": 50, "45": 100},
+	}
+	strategy, _, err := NewStrategy(StrategyPredictive, StrategyConfig{Path: "fan", Attributes: attributes})
+	assert.NoError(t, err)
+	predictive := strategy.(*Predictive)
+	ctx := context.Background()
+
+	// Without a model the table runs on the current temperature
+	now := time.Now()
+	output, err := strategy.Demand(Input{Time: now, Measurements: map[string]Measurement{PrimaryInput: {Time: now, Value: 42}}})
+	assert.NoError(t, err)
+	assert.Equal(t, 0.5, output.Level)
+	assert.Equal(t, false, output.Diagnostics["plant_model_fitted"])
+
+	// With the fans off it's going to get hotter, so the table is handed the temperature it's heading for
+	predictive.history.samples = simulatePlant(now.Add(-time.Hour), 480)
+	_, err = predictive.DoCommand(ctx, map[string]interface{}{"command": CommandFitPlantModel})
+	assert.NoError(t, err)
+	output, err = strategy.Demand(Input{Time: now, Measurements: map[string]Measurement{PrimaryInput: {Time: now, Value: 42}}})
+	assert.NoError(t, err)
+	assert.Greater(t, output.Diagnostics["predicted_temperature"], 45.0)
+	assert.Equal(t, 1.0, output.Level)
+
+	result, err := predictive.DoCommand(ctx, map[string]interface{}{"command": CommandGetPlantModel})
+	assert.NoError(t, err)
+	assert.Equal(t, true, result["fitted"])
+	assert.InDelta(t, 15, result["dead_time"], 0.001)
+
+	// Anything else is the table's
+	_, err = predictive.DoCommand(ctx, map[string]interface{}{"command": CommandExportTable})
+	assert.ErrorContains(t, err, "not adaptive")
+
+	_, _, err = NewStrategy(StrategyPredictive, StrategyConfig{Path: "fan", Attributes: map[string]interface{}{"history": 60}})
+	assert.ErrorContains(t, err, "strategy_config.history")
+}
+
+func TestPredictiveNamesQuantity(t *testing.T) {
+	attributes := map[string]interface{}{"value_table": map[string]float64{"400": 0, "1000": 100}}
+	strategy, _, err := NewStrategy(StrategyPredictive, StrategyConfig{Path: "fan", Attributes: attributes, Quantity: "co2"})
+	assert.NoError(t, err)
+
+	now := time.Now()
+	output, err := strategy.Demand(Input{Time: now, Measurements: map[string]Measurement{PrimaryInput: {Time: now, Value: 700}}})
+	assert.NoError(t, err)
+	assert.Equal(t, 700.0, output.Diagnostics["predicted_co2"])
+	assert.NotContains(t, output.Diagnostics, "predicted_temperature")
+}
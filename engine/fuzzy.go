@@ -0,0 +1,307 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"go.viam.com/rdk/resource"
+
+	"github.com/rinzlerlabs/viam-fan-controller/utils"
+)
+
+const StrategyFuzzy = "fuzzy"
+
+const (
+	// The variables every fuzzy rule base can use, any other variable is read from the input with the same name.
+	// value is the same as temperature, for quantities other than temperature.
+	fuzzyTemperature = "temperature"
+	fuzzyValue       = "value"
+	fuzzyRate        = "rate"
+
+	defaultRateWindow = 60 * time.Second
+	// How many points the output is sampled at to find its centroid
+	centroidSteps = 200
+)
+
+func init() {
+	RegisterStrategy(StrategyFuzzy, newFuzzy)
+}
+
+type fuzzyConfig struct {
+	// Variable name to term name to membership function
+	Variables map[string]map[string][]float64 `json:"variables"`
+	// Term name to membership function, over fan speeds from 0-100
+	Output     map[string][]float64 `json:"output"`
+	Rules      []fuzzyRuleConfig    `json:"rules"`
+	RateWindow int64                `json:"rate_window"`
+}
+
+type fuzzyRuleConfig struct {
+	Name string `json:"name"`
+	// Variable name to term name, every condition has to hold for the rule to fire
+	If   map[string]string `json:"if"`
+	Then string            `json:"then"`
+}
+
+// membership is a triangle (3 points) or trapezoid (4 points). Repeating the first or last point makes a shoulder
+// that covers everything beyond it, e.g. [40, 40, 50] is fully true at 40 and below.
+type membership []float64
+
+func (m membership) grade(x float64) float64 {
+	a, b, c, d := m[0], m[1], m[1], m[2]
+	if len(m) == 4 {
+		c, d = m[2], m[3]
+	}
+	switch {
+	case x < a:
+		if a == b {
+			return 1
+		}
+		return 0
+	case x > d:
+		if c == d {
+			return 1
+		}
+		return 0
+	case x < b:
+		return (x - a) / (b - a)
+	case x <= c:
+		return 1
+	default:
+		return (d - x) / (d - c)
+	}
+}
+
+func (m membership) validate(path string, field string) error {
+	if len(m) != 3 && len(m) != 4 {
+		return utils.NewFieldError(path, field, "must have 3 points for a triangle or 4 for a trapezoid, got %d", len(m))
+	}
+	for i := 1; i < len(m); i++ {
+		if m[i] < m[i-1] {
+			return utils.NewFieldError(path, field, "points must be in increasing order, got %v", []float64(m))
+		}
+	}
+	if m[0] == m[len(m)-1] {
+		return utils.NewFieldError(path, field, "points cannot all be the same, got %v", []float64(m))
+	}
+	return nil
+}
+
+type fuzzyRule struct {
+	name       string
+	conditions map[string]string
+	then       string
+}
+
+// Fuzzy runs a rule base over the temperature, how fast it's changing and any other inputs, and defuzzifies the
+// rules' conclusions to a fan speed with the centroid method
+type Fuzzy struct {
+	variables  map[string]map[string]membership
+	output     map[string]membership
+	rules      []fuzzyRule
+	rateWindow time.Duration
+	// Recent temperatures, for the rate of change
+	samples []Measurement
+	// What the rate is of, for the readings
+	quantity string
+}
+
+func newFuzzy(conf StrategyConfig) (Strategy, []utils.ConfigWarning, error) {
+	var fuzzyConf fuzzyConfig
+	if err := DecodeAttributes(conf.Attributes, &fuzzyConf); err != nil {
+		return nil, nil, utils.NewFieldError(conf.Path, "strategy_config", "%s", err)
+	}
+
+	warnings := []utils.ConfigWarning{}
+	f := &Fuzzy{
+		variables:  make(map[string]map[string]membership, len(fuzzyConf.Variables)),
+		output:     make(map[string]membership, len(fuzzyConf.Output)),
+		rateWindow: defaultRateWindow,
+		quantity:   defaultQuantity,
+	}
+	if conf.Quantity != "" {
+		f.quantity = conf.Quantity
+	}
+
+	if len(fuzzyConf.Variables) == 0 {
+		return nil, nil, resource.NewConfigValidationFieldRequiredError(conf.Path, "strategy_config.variables")
+	}
+	for name, terms := range fuzzyConf.Variables {
+		switch name {
+		case fuzzyTemperature, fuzzyValue, fuzzyRate:
+		default:
+			if err := conf.RequireInput("strategy_config.variables."+name, name); err != nil {
+				return nil, nil, err
+			}
+		}
+		f.variables[name] = make(map[string]membership, len(terms))
+		for term, points := range terms {
+			field := fmt.Sprintf("strategy_config.variables.%s.%s", name, term)
+			if err := membership(points).validate(conf.Path, field); err != nil {
+				return nil, nil, err
+			}
+			f.variables[name][term] = points
+		}
+	}
+
+	if len(fuzzyConf.Output) == 0 {
+		return nil, nil, resource.NewConfigValidationFieldRequiredError(conf.Path, "strategy_config.output")
+	}
+	for term, points := range fuzzyConf.Output {
+		field := "strategy_config.output." + term
+		if err := membership(points).validate(conf.Path, field); err != nil {
+			return nil, nil, err
+		}
+		if points[0] < 0 || points[len(points)-1] > 100 {
+			return nil, nil, utils.NewFieldError(conf.Path, field, "fan speeds must be between 0 and 100, got %v", points)
+		}
+		f.output[term] = points
+	}
+
+	if len(fuzzyConf.Rules) == 0 {
+		return nil, nil, resource.NewConfigValidationFieldRequiredError(conf.Path, "strategy_config.rules")
+	}
+	usedTerms := make(map[string]bool)
+	for i, ruleConf := range fuzzyConf.Rules {
+		field := fmt.Sprintf("strategy_config.rules[%d]", i)
+		if len(ruleConf.If) == 0 {
+			return nil, nil, resource.NewConfigValidationFieldRequiredError(conf.Path, field+".if")
+		}
+		for name, term := range ruleConf.If {
+			if _, ok := f.variables[name][term]; !ok {
+				return nil, nil, utils.NewFieldError(conf.Path, field+".if", "%s has no term %s", name, term)
+			}
+			usedTerms[name+"."+term] = true
+		}
+		if _, ok := f.output[ruleConf.Then]; !ok {
+			return nil, nil, utils.NewFieldError(conf.Path, field+".then", "output has no term %s", ruleConf.Then)
+		}
+		usedTerms["output."+ruleConf.Then] = true
+
+		rule := fuzzyRule{name: ruleConf.Name, conditions: ruleConf.If, then: ruleConf.Then}
+		if rule.name == "" {
+			rule.name = describeRule(ruleConf)
+		}
+		f.rules = append(f.rules, rule)
+	}
+
+	for name, terms := range f.variables {
+		for term := range terms {
+			if !usedTerms[name+"."+term] {
+				warnings = append(warnings, utils.NewConfigWarning(conf.Path, fmt.Sprintf("strategy_config.variables.%s.%s", name, term), "is not used by any rule"))
+			}
+		}
+	}
+	for term := range f.output {
+		if !usedTerms["output."+term] {
+			warnings = append(warnings, utils.NewConfigWarning(conf.Path, "strategy_config.output."+term, "is not used by any rule"))
+		}
+	}
+
+	if err := utils.ValidateDelay(conf.Path, "strategy_config.rate_window", fuzzyConf.RateWindow); err != nil {
+		return nil, nil, err
+	}
+	if fuzzyConf.RateWindow > 0 {
+		f.rateWindow = time.Duration(fuzzyConf.RateWindow) * time.Second
+	}
+
+	// Keep the temperature history, so a reconfigure doesn't make the rate jump
+	if previous, ok := conf.Previous.(*Fuzzy); ok {
+		f.samples = previous.samples
+	}
+	return f, warnings, nil
+}
+
+// describeRule is the name of a rule that wasn't given one, e.g. "if rate is rising and temperature is warm then high"
+func describeRule(rule fuzzyRuleConfig) string {
+	names := make([]string, 0, len(rule.If))
+	for name := range rule.If {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	conditions := make([]string, 0, len(names))
+	for _, name := range names {
+		conditions = append(conditions, fmt.Sprintf("%s is %s", name, rule.If[name]))
+	}
+	return fmt.Sprintf("if %s then %s", strings.Join(conditions, " and "), rule.Then)
+}
+
+func (f *Fuzzy) Demand(in Input) (Output, error) {
+	temp := in.Primary()
+	values := map[string]float64{
+		fuzzyTemperature: temp.Value,
+		fuzzyValue:       temp.Value,
+		fuzzyRate:        f.rate(temp),
+	}
+	for name := range f.variables {
+		if _, ok := values[name]; ok {
+			continue
+		}
+		m, ok := in.Measurements[name]
+		if !ok {
+			return Output{}, fmt.Errorf("fuzzy variable %s has no input with the same name", name)
+		}
+		values[name] = m.Value
+	}
+
+	// Each rule fires as strongly as its weakest condition, and each output term as strongly as its strongest rule
+	activations := make(map[string]interface{}, len(f.rules))
+	strengths := make(map[string]float64, len(f.output))
+	for _, rule := range f.rules {
+		activation := 1.0
+		for name, term := range rule.conditions {
+			activation = math.Min(activation, f.variables[name][term].grade(values[name]))
+		}
+		activations[rule.name] = activation
+		strengths[rule.then] = math.Max(strengths[rule.then], activation)
+	}
+
+	level := f.centroid(strengths) / 100
+	return Output{
+		Level: level,
+		Diagnostics: map[string]interface{}{
+			"rule_activations":   activations,
+			f.quantity + "_rate": values[fuzzyRate],
+		},
+	}, nil
+}
+
+// rate is how fast the temperature is changing, in degrees per minute, over the rate window
+func (f *Fuzzy) rate(m Measurement) float64 {
+	f.samples = append(f.samples, m)
+	cutoff := m.Time.Add(-f.rateWindow)
+	i := 0
+	for i < len(f.samples)-1 && f.samples[i].Time.Before(cutoff) {
+		i++
+	}
+	f.samples = f.samples[i:]
+
+	oldest := f.samples[0]
+	elapsed := m.Time.Sub(oldest.Time).Minutes()
+	if elapsed <= 0 {
+		return 0
+	}
+	return (m.Value - oldest.Value) / elapsed
+}
+
+// centroid clips each output term at its strength and finds the center of the combined shape, from 0-100.
+// If no rule fired at all there's nothing to center on, and the fans are stopped.
+func (f *Fuzzy) centroid(strengths map[string]float64) float64 {
+	var weighted, total float64
+	for i := 0; i <= centroidSteps; i++ {
+		x := 100 * float64(i) / centroidSteps
+		mu := 0.0
+		for term, strength := range strengths {
+			mu = math.Max(mu, math.Min(strength, f.output[term].grade(x)))
+		}
+		weighted += x * mu
+		total += mu
+	}
+	if total == 0 {
+		return 0
+	}
+	return weighted / total
+}
@@ -0,0 +1,122 @@
+package engine
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMembershipGrade(t *testing.T) {
+	triangle := membership{30, 40, 50}
+	assert.Equal(t, 0.0, triangle.grade(20))
+	assert.Equal(t, 0.5, triangle.grade(35))
+	assert.Equal(t, 1.0, triangle.grade(40))
+	assert.Equal(t, 0.5, triangle.grade(45))
+	assert.Equal(t, 0.0, triangle.grade(60))
+
+	trapezoid := membership{30, 40, 50, 60}
+	assert.Equal(t, 1.0, trapezoid.grade(45))
+	assert.Equal(t, 0.5, trapezoid.grade(55))
+
+	// Repeated end points are shoulders that go on forever
+	cold := membership{20, 20, 30}
+	assert.Equal(t, 1.0, cold.grade(-10))
+	hot := membership{40, 50, 50}
+	assert.Equal(t, 1.0, hot.grade(100))
+}
+
+func testFuzzyConfig() map[string]interface{} {
+	return map[string]interface{}{
+		"variables": map[string]interface{}{
+			"temperature": map[string]interface{}{"cool": []float64{30, 30, 40}, "hot": []float64{30, 40, 40}},
+			"rate":        map[string]interface{}{"steady": []float64{-1, 0, 1}, "rising": []float64{0, 1, 1}},
+		},
+		"output": map[string]interface{}{
+			"low":  []float64{0, 0, 50},
+			"high": []float64{50, 100, 100},
+		},
+		"rules": []interface{}{
+			map[string]interface{}{"if": map[string]interface{}{"temperature": "cool", "rate": "steady"}, "then": "low"},
+			map[string]interface{}{"name": "heating up", "if": map[string]interface{}{"rate": "rising"}, "then": "high"},
+			map[string]interface{}{"if": map[string]interface{}{"temperature": "hot"}, "then": "high"},
+		},
+	}
+}
+
+func TestFuzzyDemand(t *testing.T) {
+	strategy, warnings, err := NewStrategy(StrategyFuzzy, StrategyConfig{Path: "fan", Attributes: testFuzzyConfig()})
+	assert.NoError(t, err)
+	assert.Empty(t, warnings)
+	now := time.Now()
+	input := func(at time.Time, temp float64) Input {
+		return Input{Time: at, Measurements: map[string]Measurement{PrimaryInput: {Time: at, Value: temp}}}
+	}
+
+	// Cool and steady, only the low rule fires
+	output, err := strategy.Demand(input(now, 30))
+	assert.NoError(t, err)
+	assert.InDelta(t, 0.1667, output.Level, 0.01)
+	activations := output.Diagnostics["rule_activations"].(map[string]interface{})
+	assert.Equal(t, 1.0, activations["if rate is steady and temperature is cool then low"])
+	assert.Equal(t, 0.0, activations["heating up"])
+
+	// Rising a degree a minute fires the heating up rule fully, even though it's still cool
+	output, err = strategy.Demand(input(now.Add(time.Minute), 31))
+	assert.NoError(t, err)
+	assert.Equal(t, 1.0, output.Diagnostics["temperature_rate"])
+	activations = output.Diagnostics["rule_activations"].(map[string]interface{})
+	assert.Equal(t, 1.0, activations["heating up"])
+	assert.Greater(t, output.Level, 0.5)
+}
+
+func TestFuzzyRateNamedAfterQuantity(t *testing.T) {
+	strategy, _, err := NewStrategy(StrategyFuzzy, StrategyConfig{Path: "fan", Attributes: testFuzzyConfig(), Quantity: "co2"})
+	assert.NoError(t, err)
+	now := time.Now()
+
+	output, err := strategy.Demand(Input{Time: now, Measurements: map[string]Measurement{PrimaryInput: {Time: now, Value: 30}}})
+	assert.NoError(t, err)
+	assert.Contains(t, output.Diagnostics, "co2_rate")
+	assert.NotContains(t, output.Diagnostics, "temperature_rate")
+}
+
+func TestFuzzyUsesOtherInputs(t *testing.T) {
+	attributes := testFuzzyConfig()
+	attributes["variables"].(map[string]interface{})["load"] = map[string]interface{}{"busy": []float64{50, 100, 100}}
+	attributes["rules"] = append(attributes["rules"].([]interface{}), map[string]interface{}{"if": map[string]interface{}{"load": "busy"}, "then": "high"})
+
+	// A variable without an input of the same name is caught with the config, not on every pass of the loop
+	_, _, err := NewStrategy(StrategyFuzzy, StrategyConfig{Path: "fan", Attributes: attributes, Inputs: []string{PrimaryInput}})
+	assert.ErrorContains(t, err, "strategy_config.variables.load")
+
+	strategy, _, err := NewStrategy(StrategyFuzzy, StrategyConfig{Path: "fan", Attributes: attributes, Inputs: []string{PrimaryInput, "load"}})
+	assert.NoError(t, err)
+
+	now := time.Now()
+	output, err := strategy.Demand(Input{Time: now, Measurements: map[string]Measurement{
+		PrimaryInput: {Time: now, Value: 30},
+		"load":       {Time: now, Value: 100},
+	}})
+	assert.NoError(t, err)
+	assert.Equal(t, 1.0, output.Diagnostics["rule_activations"].(map[string]interface{})["if load is busy then high"])
+}
+
+func TestFuzzyValidation(t *testing.T) {
+	attributes := testFuzzyConfig()
+	attributes["rules"] = []interface{}{map[string]interface{}{"if": map[string]interface{}{"temperature": "warm"}, "then": "high"}}
+	_, _, err := NewStrategy(StrategyFuzzy, StrategyConfig{Path: "fan", Attributes: attributes})
+	assert.ErrorContains(t, err, "temperature has no term warm")
+
+	attributes = testFuzzyConfig()
+	attributes["output"].(map[string]interface{})["low"] = []float64{0, 50}
+	_, _, err = NewStrategy(StrategyFuzzy, StrategyConfig{Path: "fan", Attributes: attributes})
+	assert.ErrorContains(t, err, "strategy_config.output.low")
+
+	// Terms no rule uses are legal, but probably a mistake
+	attributes = testFuzzyConfig()
+	attributes["output"].(map[string]interface{})["medium"] = []float64{25, 50, 75}
+	_, warnings, err := NewStrategy(StrategyFuzzy, StrategyConfig{Path: "fan", Attributes: attributes})
+	assert.NoError(t, err)
+	assert.Len(t, warnings, 1)
+}
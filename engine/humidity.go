@@ -0,0 +1,179 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+
+	"go.viam.com/rdk/components/sensor"
+	"go.viam.com/rdk/resource"
+
+	"github.com/rinzlerlabs/viam-fan-controller/utils"
+)
+
+// The measurement the humidity sensor shows up as, so strategies can use it too
+const HumidityInput = "humidity"
+
+const (
+	defaultHumidityBand = 1.0
+	defaultHumidityDuty = 100.0
+
+	// Magnus formula coefficients, good to about 0.1 degrees from -45 to 60C
+	magnusB = 17.62
+	magnusC = 243.12
+
+	DemandThermal  = "thermal"
+	DemandHumidity = "humidity"
+	DemandNone     = "none"
+)
+
+// HumidityConfig runs the fans to keep condensation off, alongside whatever the strategy asks for
+type HumidityConfig struct {
+	SensorName       string `json:"sensor_name"`
+	SensorValueKey   string `json:"sensor_value_key"`
+	SensorValueRegex string `json:"sensor_value_regex"`
+	// The input the surface temperature is read from, the controller's temperature if not set
+	SurfaceInput string `json:"surface_input"`
+	// Run when the surface is within this many degrees of the dew point
+	DewPointMargin *float64 `json:"dew_point_margin"`
+	// Run when the relative humidity is at or above this, in percent
+	MaxHumidity *float64 `json:"max_humidity"`
+	// How far back past a threshold the air has to get before the fans stop again, in degrees or percent
+	Band *float64 `json:"band"`
+	// The fan speed to run at, in percent
+	Duty *float64 `json:"duty"`
+}
+
+// ValidateHumidity checks the humidity config and returns the sensor it depends on. The dew point is worked out from
+// the controller's measurement, so it has to be a temperature.
+func ValidateHumidity(path string, conf *HumidityConfig, inputs []InputConfig, quantity string) ([]string, error) {
+	if conf == nil {
+		return nil, nil
+	}
+	if quantity != "" && quantity != defaultQuantity {
+		return nil, utils.NewFieldError(path, "humidity", "needs the quantity to be %s, got %s", defaultQuantity, quantity)
+	}
+	if conf.SensorName == "" {
+		return nil, resource.NewConfigValidationFieldRequiredError(path, "humidity.sensor_name")
+	}
+	if conf.SensorValueKey == "" {
+		return nil, resource.NewConfigValidationFieldRequiredError(path, "humidity.sensor_value_key")
+	}
+	if err := utils.ValidateRegex(path, "humidity.sensor_value_regex", conf.SensorValueRegex); err != nil {
+		return nil, err
+	}
+	if conf.DewPointMargin == nil && conf.MaxHumidity == nil {
+		return nil, utils.NewFieldError(path, "humidity", "at least one of dew_point_margin or max_humidity is required")
+	}
+	if conf.DewPointMargin != nil && *conf.DewPointMargin < 0 {
+		return nil, utils.NewFieldError(path, "humidity.dew_point_margin", "cannot be negative, got %v", *conf.DewPointMargin)
+	}
+	if conf.MaxHumidity != nil && (*conf.MaxHumidity <= 0 || *conf.MaxHumidity > 100) {
+		return nil, utils.NewFieldError(path, "humidity.max_humidity", "must be above 0 and at most 100, got %v", *conf.MaxHumidity)
+	}
+	if conf.Band != nil && *conf.Band < 0 {
+		return nil, utils.NewFieldError(path, "humidity.band", "cannot be negative, got %v", *conf.Band)
+	}
+	if conf.Duty != nil && (*conf.Duty <= 0 || *conf.Duty > 100) {
+		return nil, utils.NewFieldError(path, "humidity.duty", "must be above 0 and at most 100, got %v", *conf.Duty)
+	}
+
+	found := conf.SurfaceInput == ""
+	for i, in := range inputs {
+		if in.Name == HumidityInput {
+			return nil, utils.NewFieldError(path, fmt.Sprintf("inputs[%d].name", i), "%s is already in use by humidity", in.Name)
+		}
+		if in.Name == conf.SurfaceInput {
+			found = true
+		}
+	}
+	if !found {
+		return nil, utils.NewFieldError(path, "humidity.surface_input", "there is no input named %s", conf.SurfaceInput)
+	}
+	return []string{conf.SensorName}, nil
+}
+
+// humidity is a configured humidity demand, ready to run
+type humidity struct {
+	input          input
+	surfaceInput   string
+	dewPointMargin *float64
+	maxHumidity    *float64
+	band           float64
+	duty           float64
+	// Whether the humidity was calling for the fans last time, the band only applies once it is
+	active bool
+}
+
+func newHumidity(deps resource.Dependencies, conf *HumidityConfig) (*humidity, error) {
+	if conf == nil {
+		return nil, nil
+	}
+	s, err := sensor.FromDependencies(deps, conf.SensorName)
+	if err != nil {
+		return nil, fmt.Errorf("error looking up humidity sensor %s: %w", conf.SensorName, err)
+	}
+	h := &humidity{
+		input:          input{name: HumidityInput, s: s, field: conf.SensorValueKey},
+		surfaceInput:   conf.SurfaceInput,
+		dewPointMargin: conf.DewPointMargin,
+		maxHumidity:    conf.MaxHumidity,
+		band:           defaultHumidityBand,
+		duty:           defaultHumidityDuty / 100,
+	}
+	if conf.SensorValueRegex != "" {
+		h.input.regex = regexp.MustCompile(conf.SensorValueRegex)
+	}
+	if conf.Band != nil {
+		h.band = *conf.Band
+	}
+	if conf.Duty != nil {
+		h.duty = *conf.Duty / 100
+	}
+	return h, nil
+}
+
+// dewPoint is the temperature the air would start condensing at, from its temperature and relative humidity
+func dewPoint(temperature float64, relativeHumidity float64) (float64, error) {
+	if relativeHumidity <= 0 || relativeHumidity > 100 {
+		return 0, fmt.Errorf("relative humidity must be above 0 and at most 100, got %v", relativeHumidity)
+	}
+	gamma := math.Log(relativeHumidity/100) + magnusB*temperature/(magnusC+temperature)
+	return magnusC * gamma / (magnusB - gamma), nil
+}
+
+// demand is the level the humidity calls for, and what to report about it. The dew point is worked out from the
+// controller's temperature, and the surface is that same temperature unless surface_input says otherwise.
+func (h *humidity) demand(measurements map[string]Measurement) (float64, map[string]interface{}, error) {
+	rh := measurements[HumidityInput].Value
+	temperature := measurements[PrimaryInput].Value
+	dew, err := dewPoint(temperature, rh)
+	if err != nil {
+		return 0, nil, err
+	}
+	surface := temperature
+	if h.surfaceInput != "" {
+		surface = measurements[h.surfaceInput].Value
+	}
+
+	// Once running, the air has to get band clear of a threshold before the fans stop
+	band := 0.0
+	if h.active {
+		band = h.band
+	}
+	condensing := h.dewPointMargin != nil && surface-dew <= *h.dewPointMargin+band
+	humid := h.maxHumidity != nil && rh >= *h.maxHumidity-band
+	h.active = condensing || humid
+
+	diagnostics := map[string]interface{}{
+		"humidity":            rh,
+		"dew_point":           dew,
+		"dew_point_spread":    surface - dew,
+		"condensation_risk":   condensing,
+		"humidity_over_limit": humid,
+	}
+	if h.active {
+		return h.duty, diagnostics, nil
+	}
+	return 0, diagnostics, nil
+}
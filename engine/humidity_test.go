@@ -0,0 +1,76 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDewPoint(t *testing.T) {
+	dew, err := dewPoint(20, 50)
+	assert.NoError(t, err)
+	assert.InDelta(t, 9.3, dew, 0.1)
+
+	// Saturated air condenses at its own temperature
+	dew, err = dewPoint(15, 100)
+	assert.NoError(t, err)
+	assert.InDelta(t, 15, dew, 0.001)
+
+	_, err = dewPoint(20, 0)
+	assert.Error(t, err)
+}
+
+func TestHumidityDemand(t *testing.T) {
+	margin := 3.0
+	h := &humidity{surfaceInput: "wall", dewPointMargin: &margin, band: 1, duty: 1}
+	measurements := func(air, rh, wall float64) map[string]Measurement {
+		return map[string]Measurement{
+			PrimaryInput:  {Value: air},
+			HumidityInput: {Value: rh},
+			"wall":        {Value: wall},
+		}
+	}
+
+	// 20C at 50% has a dew point of about 9.3C, a 14C wall is well clear of it
+	level, diagnostics, err := h.demand(measurements(20, 50, 14))
+	assert.NoError(t, err)
+	assert.Equal(t, 0.0, level)
+	assert.Equal(t, false, diagnostics["condensation_risk"])
+
+	// A 12C wall is within 3 degrees
+	level, diagnostics, err = h.demand(measurements(20, 50, 12))
+	assert.NoError(t, err)
+	assert.Equal(t, 1.0, level)
+	assert.Equal(t, true, diagnostics["condensation_risk"])
+
+	// Once running it has to get a degree further clear before stopping
+	level, _, err = h.demand(measurements(20, 50, 12.5))
+	assert.NoError(t, err)
+	assert.Equal(t, 1.0, level)
+	level, _, err = h.demand(measurements(20, 50, 13.5))
+	assert.NoError(t, err)
+	assert.Equal(t, 0.0, level)
+}
+
+func TestValidateHumidity(t *testing.T) {
+	margin := 2.0
+	deps, err := ValidateHumidity("fan", &HumidityConfig{SensorName: "rh", SensorValueKey: "humidity", DewPointMargin: &margin}, nil, "")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"rh"}, deps)
+
+	_, err = ValidateHumidity("fan", &HumidityConfig{SensorName: "rh", SensorValueKey: "humidity"}, nil, "")
+	assert.ErrorContains(t, err, "dew_point_margin or max_humidity")
+
+	_, err = ValidateHumidity("fan", &HumidityConfig{SensorName: "rh", SensorValueKey: "humidity", DewPointMargin: &margin, SurfaceInput: "wall"}, nil, "")
+	assert.ErrorContains(t, err, "humidity.surface_input")
+
+	inputs := []InputConfig{{Name: "humidity", SensorName: "other", SensorValueKey: "rh"}}
+	_, err = ValidateHumidity("fan", &HumidityConfig{SensorName: "rh", SensorValueKey: "humidity", DewPointMargin: &margin}, inputs, "")
+	assert.ErrorContains(t, err, "already in use")
+
+	// The dew point needs a temperature to work from
+	_, err = ValidateHumidity("fan", &HumidityConfig{SensorName: "rh", SensorValueKey: "humidity", DewPointMargin: &margin}, nil, "temperature")
+	assert.NoError(t, err)
+	_, err = ValidateHumidity("fan", &HumidityConfig{SensorName: "rh", SensorValueKey: "humidity", MaxHumidity: &margin}, nil, "co2")
+	assert.ErrorContains(t, err, "needs the quantity to be temperature")
+}
@@ -0,0 +1,134 @@
+package engine
+
+import (
+	"time"
+
+	"go.viam.com/rdk/resource"
+
+	"github.com/rinzlerlabs/viam-fan-controller/utils"
+)
+
+const StrategyHysteresis = "hysteresis"
+
+func init() {
+	RegisterStrategy(StrategyHysteresis, newHysteresis)
+}
+
+type hysteresisConfig struct {
+	OnTemperature  *float64 `json:"on_temperature"`
+	OffTemperature *float64 `json:"off_temperature"`
+	// on_value and off_value are the same things, for quantities other than temperature
+	OnValue   *float64 `json:"on_value"`
+	OffValue  *float64 `json:"off_value"`
+	OnDelay   int64    `json:"on_delay"`
+	OffDelay  int64    `json:"off_delay"`
+	Direction string   `json:"direction"`
+}
+
+// Hysteresis turns the fans fully on at OnTemperature and back off below OffTemperature, waiting at least
+// OnDelay or OffDelay since the last change before switching. When heating it's the other way up, on at or below
+// OnTemperature and off above OffTemperature.
+type Hysteresis struct {
+	OnTemperature  float64
+	OffTemperature float64
+	OnDelay        time.Duration
+	OffDelay       time.Duration
+	Direction      Direction
+}
+
+func newHysteresis(conf StrategyConfig) (Strategy, []utils.ConfigWarning, error) {
+	var hystConf hysteresisConfig
+	if err := DecodeAttributes(conf.Attributes, &hystConf); err != nil {
+		return nil, nil, utils.NewFieldError(conf.Path, "strategy_config", "%s", err)
+	}
+
+	warnings := []utils.ConfigWarning{}
+	onField, onValue, err := aliased(conf.Path, "on_temperature", hystConf.OnTemperature, "on_value", hystConf.OnValue)
+	if err != nil {
+		return nil, nil, err
+	}
+	if onValue == nil {
+		return nil, nil, resource.NewConfigValidationFieldRequiredError(conf.Path, onField)
+	}
+
+	offField, offValue, err := aliased(conf.Path, "off_temperature", hystConf.OffTemperature, "off_value", hystConf.OffValue)
+	if err != nil {
+		return nil, nil, err
+	}
+	if offValue == nil {
+		return nil, nil, resource.NewConfigValidationFieldRequiredError(conf.Path, offField)
+	}
+
+	direction, err := ParseDirection(conf.Path, hystConf.Direction)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// The fans switch off on the far side of the band from where they switched on
+	band := direction.past(*onValue, *offValue)
+	if band <= 0 {
+		comparison := "less"
+		if direction == DirectionHeating {
+			comparison = "greater"
+		}
+		return nil, nil, utils.NewFieldError(conf.Path, offField, "must be %s than %s %v, got %v", comparison, onField, *onValue, *offValue)
+	}
+
+	if err := utils.ValidateDelay(conf.Path, "on_delay", hystConf.OnDelay); err != nil {
+		return nil, nil, err
+	}
+
+	if err := utils.ValidateDelay(conf.Path, "off_delay", hystConf.OffDelay); err != nil {
+		return nil, nil, err
+	}
+
+	// A narrow band with no delays will chatter the fan on and off with sensor noise
+	if band < 1 && hystConf.OnDelay == 0 && hystConf.OffDelay == 0 {
+		warnings = append(warnings, utils.NewConfigWarning(conf.Path, offField, "is within 1 of %s with no on_delay or off_delay, the fan may switch rapidly", onField))
+	}
+
+	return &Hysteresis{
+		OnTemperature:  *onValue,
+		OffTemperature: *offValue,
+		OnDelay:        time.Duration(hystConf.OnDelay * int64(time.Second)),
+		OffDelay:       time.Duration(hystConf.OffDelay * int64(time.Second)),
+		Direction:      direction,
+	}, warnings, nil
+}
+
+func (h *Hysteresis) Demand(in Input) (Output, error) {
+	currentTemp := in.Primary().Value
+	isRunning := in.State.Level > 0
+	if shouldTurnFanOn(h.Direction, currentTemp, h.OnTemperature, isRunning, h.OnDelay, in.State.LastChange) {
+		return Output{Level: 1}, nil
+	}
+	if shouldTurnFanOff(h.Direction, currentTemp, h.OffTemperature, isRunning, h.OffDelay, in.State.LastChange) {
+		return Output{Level: 0}, nil
+	}
+	if isRunning {
+		return Output{Level: 1}, nil
+	}
+	return Output{Level: 0}, nil
+}
+
+// aliased picks whichever of a temperature field and its quantity neutral alias is set, and the name it was set
+// under. They mean the same thing, so setting both is an error.
+func aliased(path string, field string, value *float64, alias string, aliasValue *float64) (string, *float64, error) {
+	if aliasValue == nil {
+		return field, value, nil
+	}
+	if value != nil {
+		return "", nil, utils.NewFieldError(path, alias, "cannot be combined with %s", field)
+	}
+	return alias, aliasValue, nil
+}
+
+// If the current temp is calling for the fan to be on, and the fan isn't on, and the last state change was long enough ago, turn the fan on
+func shouldTurnFanOn(direction Direction, currentTemp float64, onTemp float64, isRunning bool, onDelay time.Duration, lastStateChange time.Time) bool {
+	return direction.reached(currentTemp, onTemp) && !isRunning && lastStateChange.Add(onDelay).UnixMilli() < time.Now().UnixMilli()
+}
+
+// If the current temp is calling for the fan to be off, and the fan is on, and the last state change was long enough ago, turn the fan off
+func shouldTurnFanOff(direction Direction, currentTemp float64, offTemp float64, isRunning bool, offDelay time.Duration, lastStateChange time.Time) bool {
+	return !direction.reached(currentTemp, offTemp) && isRunning && lastStateChange.Add(offDelay).UnixMilli() < time.Now().UnixMilli()
+}
@@ -0,0 +1,101 @@
+package engine
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShouldTurnFanOn(t *testing.T) {
+	// Temperature is below threshold, fan is off, and last state change was more than 1 second ago, fan should stay off
+	lastStateChange := time.Now().Add(-2 * time.Second)
+	assert.False(t, shouldTurnFanOn(DirectionCooling, 25, 30, false, time.Duration(1*time.Second), lastStateChange))
+
+	// Temperature is above threshold, fan is off, and last state change was more than 1 second ago, fan should turn on
+	lastStateChange = time.Now().Add(-2 * time.Second)
+	assert.True(t, shouldTurnFanOn(DirectionCooling, 30, 30, false, time.Duration(1*time.Second), lastStateChange))
+
+	// Temperature is above threshold, fan is on, and last state change was more than 1 second ago, fan should stay on
+	lastStateChange = time.Now().Add(-2 * time.Second)
+	assert.False(t, shouldTurnFanOn(DirectionCooling, 30, 30, true, time.Duration(1*time.Second), lastStateChange))
+
+	// Temperature is above threshold, fan is off, and last state change was less than 1 second ago, fan should stay off
+	lastStateChange = time.Now().Add(-500 * time.Millisecond)
+	assert.False(t, shouldTurnFanOn(DirectionCooling, 30, 30, false, time.Duration(1*time.Second), lastStateChange))
+}
+
+func TestShouldTurnFanOff(t *testing.T) {
+	// Temperature is above threshold, fan is on, and last state change was more than 1 second ago, fan should stay on
+	lastStateChange := time.Now().Add(-2 * time.Second)
+	assert.False(t, shouldTurnFanOff(DirectionCooling, 30, 30, true, time.Duration(1*time.Second), lastStateChange))
+
+	// Temperature is below threshold, fan is on, and last state change was more than 1 second ago, fan should turn off
+	lastStateChange = time.Now().Add(-2 * time.Second)
+	assert.True(t, shouldTurnFanOff(DirectionCooling, 25, 30, true, time.Duration(1*time.Second), lastStateChange))
+
+	// Temperature is below threshold, fan is off, and last state change was more than 1 second ago, fan should stay off
+	lastStateChange = time.Now().Add(-2 * time.Second)
+	assert.False(t, shouldTurnFanOff(DirectionCooling, 25, 30, false, time.Duration(1*time.Second), lastStateChange))
+
+	// Temperature is below threshold, fan is on, and last state change was less than 1 second ago, fan should stay on
+	lastStateChange = time.Now().Add(-500 * time.Millisecond)
+	assert.False(t, shouldTurnFanOff(DirectionCooling, 25, 30, true, time.Duration(1*time.Second), lastStateChange))
+}
+
+func TestShouldTurnFanOnHeating(t *testing.T) {
+	// Temperature is above threshold, fan is off, fan should stay off
+	lastStateChange := time.Now().Add(-2 * time.Second)
+	assert.False(t, shouldTurnFanOn(DirectionHeating, 35, 30, false, time.Duration(1*time.Second), lastStateChange))
+
+	// Temperature is at or below threshold, fan is off, and last state change was more than 1 second ago, fan should turn on
+	assert.True(t, shouldTurnFanOn(DirectionHeating, 30, 30, false, time.Duration(1*time.Second), lastStateChange))
+	assert.True(t, shouldTurnFanOn(DirectionHeating, 20, 30, false, time.Duration(1*time.Second), lastStateChange))
+
+	// Temperature is below threshold, fan is off, and last state change was less than 1 second ago, fan should stay off
+	lastStateChange = time.Now().Add(-500 * time.Millisecond)
+	assert.False(t, shouldTurnFanOn(DirectionHeating, 20, 30, false, time.Duration(1*time.Second), lastStateChange))
+}
+
+func TestShouldTurnFanOffHeating(t *testing.T) {
+	// Temperature is at or below threshold, fan is on, fan should stay on
+	lastStateChange := time.Now().Add(-2 * time.Second)
+	assert.False(t, shouldTurnFanOff(DirectionHeating, 35, 35, true, time.Duration(1*time.Second), lastStateChange))
+
+	// Temperature is above threshold, fan is on, and last state change was more than 1 second ago, fan should turn off
+	assert.True(t, shouldTurnFanOff(DirectionHeating, 36, 35, true, time.Duration(1*time.Second), lastStateChange))
+
+	// Temperature is above threshold, fan is on, and last state change was less than 1 second ago, fan should stay on
+	lastStateChange = time.Now().Add(-500 * time.Millisecond)
+	assert.False(t, shouldTurnFanOff(DirectionHeating, 36, 35, true, time.Duration(1*time.Second), lastStateChange))
+}
+
+func TestHysteresisDirection(t *testing.T) {
+	heating := map[string]interface{}{"on_temperature": 10, "off_temperature": 15, "direction": "heating"}
+	strategy, _, err := NewStrategy(StrategyHysteresis, StrategyConfig{Path: "fan", Attributes: heating})
+	assert.NoError(t, err)
+	past := time.Now().Add(-time.Minute)
+	output, err := strategy.Demand(Input{Measurements: map[string]Measurement{PrimaryInput: {Value: 8}}, State: State{LastChange: past}})
+	assert.NoError(t, err)
+	assert.Equal(t, 1.0, output.Level)
+
+	// The band is the other way up when heating
+	_, _, err = NewStrategy(StrategyHysteresis, StrategyConfig{Path: "fan", Attributes: map[string]interface{}{"on_temperature": 15, "off_temperature": 10, "direction": "heating"}})
+	assert.ErrorContains(t, err, "must be greater than on_temperature")
+
+	_, _, err = NewStrategy(StrategyHysteresis, StrategyConfig{Path: "fan", Attributes: map[string]interface{}{"on_temperature": 15, "off_temperature": 10, "direction": "sideways"}})
+	assert.ErrorContains(t, err, "direction")
+}
+
+func TestHysteresisValueAliases(t *testing.T) {
+	strategy, _, err := NewStrategy(StrategyHysteresis, StrategyConfig{Path: "fan", Attributes: map[string]interface{}{"on_value": 1000, "off_value": 800}})
+	assert.NoError(t, err)
+	assert.Equal(t, 1000.0, strategy.(*Hysteresis).OnTemperature)
+	assert.Equal(t, 800.0, strategy.(*Hysteresis).OffTemperature)
+
+	_, _, err = NewStrategy(StrategyHysteresis, StrategyConfig{Path: "fan", Attributes: map[string]interface{}{"on_value": 1000, "on_temperature": 30, "off_value": 800}})
+	assert.ErrorContains(t, err, "cannot be combined with on_temperature")
+
+	_, _, err = NewStrategy(StrategyHysteresis, StrategyConfig{Path: "fan", Attributes: map[string]interface{}{"on_value": 1000, "off_value": 1200}})
+	assert.ErrorContains(t, err, "off_value")
+}
@@ -0,0 +1,106 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"time"
+
+	"go.viam.com/rdk/components/sensor"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/resource"
+
+	"github.com/rinzlerlabs/viam-fan-controller/utils"
+)
+
+// InputConfig is an extra measurement for strategies that use more than the primary one, e.g. a load or humidity
+type InputConfig struct {
+	Name             string `json:"name"`
+	SensorName       string `json:"sensor_name"`
+	SensorValueKey   string `json:"sensor_value_key"`
+	SensorValueRegex string `json:"sensor_value_regex"`
+}
+
+// input is a configured extra measurement, ready to read
+type input struct {
+	name  string
+	s     sensor.Sensor
+	field string
+	regex *regexp.Regexp
+}
+
+// ValidateInputs checks the inputs config and returns the sensors it depends on. Inputs show up in readings under
+// their names, so they can't take a name the controller already reports, or one the fuzzy strategy would hide.
+func ValidateInputs(path string, inputs []InputConfig, quantity string) ([]string, error) {
+	if quantity == "" {
+		quantity = defaultQuantity
+	}
+	reserved := append([]string{PrimaryInput, quantity, fuzzyTemperature, fuzzyValue, fuzzyRate}, reservedReadings...)
+
+	deps := []string{}
+	seen := make(map[string]bool, len(inputs))
+	for i, in := range inputs {
+		field := fmt.Sprintf("inputs[%d]", i)
+		if in.Name == "" {
+			return nil, resource.NewConfigValidationFieldRequiredError(path, field+".name")
+		}
+		if slices.Contains(reserved, in.Name) || seen[in.Name] {
+			return nil, utils.NewFieldError(path, field+".name", "%s is already in use", in.Name)
+		}
+		seen[in.Name] = true
+
+		if in.SensorName == "" {
+			return nil, resource.NewConfigValidationFieldRequiredError(path, field+".sensor_name")
+		}
+		if in.SensorValueKey == "" {
+			return nil, resource.NewConfigValidationFieldRequiredError(path, field+".sensor_value_key")
+		}
+		if err := utils.ValidateRegex(path, field+".sensor_value_regex", in.SensorValueRegex); err != nil {
+			return nil, err
+		}
+		deps = append(deps, in.SensorName)
+	}
+	return deps, nil
+}
+
+// InputNames is every measurement a strategy is given, the primary one, the inputs and the humidity if it's configured
+func InputNames(inputs []InputConfig, humidity *HumidityConfig) []string {
+	names := []string{PrimaryInput}
+	for _, in := range inputs {
+		names = append(names, in.Name)
+	}
+	if humidity != nil {
+		names = append(names, HumidityInput)
+	}
+	return names
+}
+
+func newInputs(deps resource.Dependencies, inputs []InputConfig) ([]input, error) {
+	result := make([]input, 0, len(inputs))
+	for _, in := range inputs {
+		s, err := sensor.FromDependencies(deps, in.SensorName)
+		if err != nil {
+			return nil, fmt.Errorf("error looking up sensor %s for input %s: %w", in.SensorName, in.Name, err)
+		}
+		var regex *regexp.Regexp
+		if in.SensorValueRegex != "" {
+			regex = regexp.MustCompile(in.SensorValueRegex)
+		}
+		result = append(result, input{name: in.Name, s: s, field: in.SensorValueKey, regex: regex})
+	}
+	return result, nil
+}
+
+// measure reads the input's current value, the same way the primary measurement is read
+func (in *input) measure(ctx context.Context, timeout time.Duration, logger logging.Logger) (float64, error) {
+	readings, err := utils.ReadSensor(ctx, in.s, timeout)
+	if err != nil {
+		return 0, fmt.Errorf("error getting readings for input %s: %w", in.name, err)
+	}
+	value, err := utils.ParseCurrentTemperatureFromReadings(ctx, readings, in.field, in.regex, logger)
+	if err != nil {
+		return 0, fmt.Errorf("error parsing input %s: %w", in.name, err)
+	}
+	return value, nil
+}
@@ -0,0 +1,120 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"go.viam.com/rdk/components/motor"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/resource"
+)
+
+// fanMotor exposes the fan controller through the motor API so it can be nudged from the Control tab or SDKs.
+// SetPower is a timed manual override, Stop hands control back to the strategy.
+type fanMotor struct {
+	*Controller
+}
+
+// NewMotor starts a controller for model behind the motor API
+func NewMotor(ctx context.Context, deps resource.Dependencies, conf resource.Config, logger logging.Logger, model Model) (motor.Motor, error) {
+	c, err := New(ctx, deps, conf, logger, model)
+	if err != nil {
+		return nil, err
+	}
+	return &fanMotor{Controller: c}, nil
+}
+
+func (m *fanMotor) SetPower(ctx context.Context, powerPct float64, extra map[string]interface{}) error {
+	if math.Abs(powerPct) > 1 {
+		return fmt.Errorf("power must be between -1 and 1, got %f", powerPct)
+	}
+	// Fans only spin one way, the direction is decided by the actuator's config
+	level := math.Abs(powerPct)
+	// Forcing the fans changes the actuator's state, so this needs the lock to itself, the same as a pass of the loop
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	duration := m.setOverrideLocked(level)
+	if err := m.settings.Actuator.Force(ctx, level); err != nil {
+		// The fans never got there, don't leave an override pretending they did
+		m.clearOverrideLocked()
+		return err
+	}
+	m.logger.Infof("Manual override to %f for %s", level, duration)
+	return nil
+}
+
+func (m *fanMotor) GoFor(ctx context.Context, rpm, revolutions float64, extra map[string]interface{}) error {
+	return fmt.Errorf("motor named %s does not support GoFor", m.Name().ShortName())
+}
+
+func (m *fanMotor) GoTo(ctx context.Context, rpm, positionRevolutions float64, extra map[string]interface{}) error {
+	return motor.NewGoToUnsupportedError(m.Name().ShortName())
+}
+
+func (m *fanMotor) SetRPM(ctx context.Context, rpm float64, extra map[string]interface{}) error {
+	return motor.NewSetRPMUnsupportedError(m.Name().ShortName())
+}
+
+func (m *fanMotor) ResetZeroPosition(ctx context.Context, offset float64, extra map[string]interface{}) error {
+	return motor.NewResetZeroPositionUnsupportedError(m.Name().ShortName())
+}
+
+func (m *fanMotor) Position(ctx context.Context, extra map[string]interface{}) (float64, error) {
+	return 0, errors.New("fan controllers do not report position")
+}
+
+func (m *fanMotor) Properties(ctx context.Context, extra map[string]interface{}) (motor.Properties, error) {
+	return motor.Properties{PositionReporting: false}, nil
+}
+
+func (m *fanMotor) IsPowered(ctx context.Context, extra map[string]interface{}) (bool, float64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	state, err := m.settings.Actuator.State(ctx)
+	if err != nil {
+		return false, 0, err
+	}
+	return state.Level > 0, state.Level, nil
+}
+
+func (m *fanMotor) IsMoving(ctx context.Context) (bool, error) {
+	isPowered, _, err := m.IsPowered(ctx, nil)
+	return isPowered, err
+}
+
+// Stop ends any manual override, the fan doesn't actually stop unless the strategy says it should
+func (m *fanMotor) Stop(ctx context.Context, extra map[string]interface{}) error {
+	m.clearOverride()
+	m.logger.Infof("Manual override cleared, returning to automatic control")
+	return nil
+}
+
+// setOverrideLocked holds the fans at level for the configured override duration, which it returns. It expects the
+// caller to hold c.mu.
+func (c *Controller) setOverrideLocked(level float64) time.Duration {
+	c.overrideLevel = level
+	c.overrideUntil = time.Now().Add(c.settings.OverrideDuration)
+	return c.settings.OverrideDuration
+}
+
+func (c *Controller) clearOverride() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.clearOverrideLocked()
+}
+
+// clearOverrideLocked expects the caller to hold c.mu
+func (c *Controller) clearOverrideLocked() {
+	c.overrideUntil = time.Time{}
+}
+
+// activeOverrideLocked expects the caller to hold c.mu
+func (c *Controller) activeOverrideLocked() (float64, bool) {
+	if time.Now().Before(c.overrideUntil) {
+		return c.overrideLevel, true
+	}
+	return 0, false
+}
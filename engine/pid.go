@@ -0,0 +1,272 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"go.viam.com/rdk/resource"
+
+	"github.com/rinzlerlabs/viam-fan-controller/utils"
+)
+
+const StrategyPID = "pid"
+
+const (
+	ScheduleOnError   = "error"
+	ScheduleOnAmbient = "ambient"
+	ScheduleOnDuty    = "duty"
+
+	// The gains configured directly on the pid, used whenever no scheduled set matches
+	defaultGainSet = "default"
+)
+
+func init() {
+	RegisterStrategy(StrategyPID, newPID)
+}
+
+// PIDConfig is the pid attribute
+type PIDConfig struct {
+	Setpoint float64             `json:"setpoint"`
+	Kp       float64             `json:"kp"`
+	Ki       float64             `json:"ki"`
+	Kd       float64             `json:"kd"`
+	Schedule *GainScheduleConfig `json:"schedule"`
+}
+
+// GainScheduleConfig switches between sets of gains depending on where the controller is operating
+type GainScheduleConfig struct {
+	// What picks the set: error, ambient or duty
+	On string `json:"on"`
+	// The input to read for ambient, defaults to ambient
+	Input string          `json:"input"`
+	Sets  []GainSetConfig `json:"sets"`
+}
+
+// GainSetConfig is used while the scheduled value is from Min up to, but not including, Max. Either can be left out.
+type GainSetConfig struct {
+	Name string   `json:"name"`
+	Min  *float64 `json:"min"`
+	Max  *float64 `json:"max"`
+	Kp   float64  `json:"kp"`
+	Ki   float64  `json:"ki"`
+	Kd   float64  `json:"kd"`
+}
+
+type pidStrategyConfig struct {
+	PID       *PIDConfig `json:"pid"`
+	Direction string     `json:"direction"`
+}
+
+func validateGains(path string, field string, kp, ki, kd float64) error {
+	if kp < 0 || ki < 0 || kd < 0 {
+		return utils.NewFieldError(path, field, "gains cannot be negative")
+	}
+	if kp == 0 && ki == 0 && kd == 0 {
+		return utils.NewFieldError(path, field, "at least one of kp, ki or kd is required")
+	}
+	return nil
+}
+
+func (s *GainScheduleConfig) validate(path string) error {
+	switch s.On {
+	case ScheduleOnError, ScheduleOnAmbient, ScheduleOnDuty:
+	default:
+		return utils.NewFieldError(path, "pid.schedule.on", "must be one of %s, %s or %s, got %s", ScheduleOnError, ScheduleOnAmbient, ScheduleOnDuty, s.On)
+	}
+	if s.Input != "" && s.On != ScheduleOnAmbient {
+		return utils.NewFieldError(path, "pid.schedule.input", "only applies when scheduling on %s", ScheduleOnAmbient)
+	}
+	if len(s.Sets) == 0 {
+		return resource.NewConfigValidationFieldRequiredError(path, "pid.schedule.sets")
+	}
+
+	seen := map[string]bool{defaultGainSet: true}
+	for i, set := range s.Sets {
+		field := fmt.Sprintf("pid.schedule.sets[%d]", i)
+		if set.Name == "" {
+			return resource.NewConfigValidationFieldRequiredError(path, field+".name")
+		}
+		if seen[set.Name] {
+			return utils.NewFieldError(path, field+".name", "%s is already in use", set.Name)
+		}
+		seen[set.Name] = true
+		if set.Min != nil && set.Max != nil && *set.Min >= *set.Max {
+			return utils.NewFieldError(path, field+".max", "must be greater than min %v, got %v", *set.Min, *set.Max)
+		}
+		if err := validateGains(path, field, set.Kp, set.Ki, set.Kd); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GainSet is one set of PID gains and where it applies
+type GainSet struct {
+	Name string
+	// -Inf and +Inf when not configured
+	Min float64
+	Max float64
+	Kp  float64
+	Ki  float64
+	Kd  float64
+}
+
+// GainSchedule picks the gains from the first set whose range holds the scheduled value
+type GainSchedule struct {
+	On    string
+	Input string
+	Sets  []GainSet
+}
+
+// PID computes a duty that runs harder the further the temperature is above the setpoint, or below it when heating.
+// With a schedule the gains change with the operating point, and the output carries on smoothly when they do.
+type PID struct {
+	Setpoint  float64
+	Kp        float64
+	Ki        float64
+	Kd        float64
+	Direction Direction
+	Schedule  *GainSchedule
+	// The integral's contribution to the output, kept as a term rather than a sum so a change of Ki doesn't jump it
+	iTerm      float64
+	lastError  float64
+	lastTime   time.Time
+	lastOutput float64
+	active     string
+}
+
+func newPID(conf StrategyConfig) (Strategy, []utils.ConfigWarning, error) {
+	var pidConf pidStrategyConfig
+	if err := DecodeAttributes(conf.Attributes, &pidConf); err != nil {
+		return nil, nil, utils.NewFieldError(conf.Path, "strategy_config", "%s", err)
+	}
+	if pidConf.PID == nil {
+		return nil, nil, resource.NewConfigValidationFieldRequiredError(conf.Path, "pid")
+	}
+	if err := validateGains(conf.Path, "pid", pidConf.PID.Kp, pidConf.PID.Ki, pidConf.PID.Kd); err != nil {
+		return nil, nil, err
+	}
+
+	direction, err := ParseDirection(conf.Path, pidConf.Direction)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	p := &PID{
+		Setpoint:  pidConf.PID.Setpoint,
+		Kp:        pidConf.PID.Kp,
+		Ki:        pidConf.PID.Ki,
+		Kd:        pidConf.PID.Kd,
+		Direction: direction,
+	}
+
+	if schedule := pidConf.PID.Schedule; schedule != nil {
+		if err := schedule.validate(conf.Path); err != nil {
+			return nil, nil, err
+		}
+		p.Schedule = &GainSchedule{On: schedule.On, Input: schedule.Input}
+		if p.Schedule.On == ScheduleOnAmbient && p.Schedule.Input == "" {
+			p.Schedule.Input = ScheduleOnAmbient
+		}
+		if p.Schedule.On == ScheduleOnAmbient {
+			if err := conf.RequireInput("pid.schedule.input", p.Schedule.Input); err != nil {
+				return nil, nil, err
+			}
+		}
+		for _, set := range schedule.Sets {
+			gains := GainSet{Name: set.Name, Min: math.Inf(-1), Max: math.Inf(1), Kp: set.Kp, Ki: set.Ki, Kd: set.Kd}
+			if set.Min != nil {
+				gains.Min = *set.Min
+			}
+			if set.Max != nil {
+				gains.Max = *set.Max
+			}
+			p.Schedule.Sets = append(p.Schedule.Sets, gains)
+		}
+	}
+
+	// Pick up where the running PID left off, the first update treats any change of gains as a switch of set
+	if previous, ok := conf.Previous.(*PID); ok {
+		p.iTerm = previous.iTerm
+		p.lastError = previous.lastError
+		p.lastTime = previous.lastTime
+		p.lastOutput = previous.lastOutput
+	}
+	return p, nil, nil
+}
+
+func (p *PID) Demand(in Input) (Output, error) {
+	m := in.Primary()
+	gains, err := p.gains(in, p.Direction.past(m.Value, p.Setpoint))
+	if err != nil {
+		return Output{}, err
+	}
+	return Output{
+		Level:       p.updateWith(gains, m.Time, m.Value),
+		Diagnostics: map[string]interface{}{"pid_gain_set": p.active},
+	}, nil
+}
+
+// gains picks the gain set for where the controller is operating now
+func (p *PID) gains(in Input, err float64) (GainSet, error) {
+	defaults := GainSet{Name: defaultGainSet, Kp: p.Kp, Ki: p.Ki, Kd: p.Kd}
+	if p.Schedule == nil {
+		return defaults, nil
+	}
+
+	var value float64
+	switch p.Schedule.On {
+	case ScheduleOnError:
+		value = err
+	case ScheduleOnDuty:
+		value = p.lastOutput * 100
+	case ScheduleOnAmbient:
+		m, ok := in.Measurements[p.Schedule.Input]
+		if !ok {
+			return GainSet{}, fmt.Errorf("pid schedule input %s is not configured in inputs", p.Schedule.Input)
+		}
+		value = m.Value
+	}
+
+	for _, set := range p.Schedule.Sets {
+		if value >= set.Min && value < set.Max {
+			return set, nil
+		}
+	}
+	return defaults, nil
+}
+
+func (p *PID) update(now time.Time, currentTemp float64) float64 {
+	return p.updateWith(GainSet{Name: defaultGainSet, Kp: p.Kp, Ki: p.Ki, Kd: p.Kd}, now, currentTemp)
+}
+
+func (p *PID) updateWith(gains GainSet, now time.Time, currentTemp float64) float64 {
+	err := p.Direction.past(currentTemp, p.Setpoint)
+	var dt, derivative float64
+	if !p.lastTime.IsZero() {
+		dt = now.Sub(p.lastTime).Seconds()
+		if dt > 0 {
+			derivative = (err - p.lastError) / dt
+		}
+	}
+
+	// Bumpless transfer, the integral term takes up whatever the new gains change so the output doesn't jump
+	if gains.Name != p.active {
+		if !p.lastTime.IsZero() {
+			p.iTerm = p.lastOutput - gains.Kp*err - gains.Kd*derivative
+		}
+		p.active = gains.Name
+	}
+
+	iTerm := p.iTerm + gains.Ki*err*dt
+	output := gains.Kp*err + iTerm + gains.Kd*derivative
+	// Only keep integrating while the output isn't pinned, otherwise the integral winds up and overshoots
+	if (output < 1 || err < 0) && (output > 0 || err > 0) {
+		p.iTerm = iTerm
+	}
+	p.lastError = err
+	p.lastTime = now
+	p.lastOutput = math.Max(0, math.Min(1, output))
+	return p.lastOutput
+}
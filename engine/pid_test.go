@@ -0,0 +1,159 @@
+package engine
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPIDController(t *testing.T) {
+	pid := &PID{Setpoint: 40, Kp: 0.1}
+	now := time.Now()
+
+	assert.Equal(t, 0.0, pid.update(now, 35))
+	assert.InDelta(t, 0.5, pid.update(now.Add(time.Second), 45), 0.0001)
+	assert.Equal(t, 1.0, pid.update(now.Add(2*time.Second), 60))
+
+	// The integral only accumulates while the output isn't saturated
+	pid = &PID{Setpoint: 40, Kp: 1, Ki: 1}
+	pid.update(now, 50)
+	pid.update(now.Add(10*time.Second), 50)
+	assert.Equal(t, 0.0, pid.iTerm)
+	pid = &PID{Setpoint: 40, Ki: 0.01}
+	pid.update(now, 41)
+	pid.update(now.Add(10*time.Second), 41)
+	assert.InDelta(t, 0.1, pid.iTerm, 0.0001)
+}
+
+func testScheduledPID(t *testing.T, schedule map[string]interface{}) Strategy {
+	pid := map[string]interface{}{"setpoint": 40, "kp": 0.05, "ki": 0.001, "schedule": schedule}
+	strategy, _, err := NewStrategy(StrategyPID, StrategyConfig{Path: "fan", Attributes: map[string]interface{}{"pid": pid}, Inputs: []string{PrimaryInput, "ambient"}})
+	assert.NoError(t, err)
+	return strategy
+}
+
+func TestPIDGainSchedule(t *testing.T) {
+	now := time.Now()
+	strategy := testScheduledPID(t, map[string]interface{}{
+		"on": "ambient",
+		"sets": []interface{}{
+			map[string]interface{}{"name": "winter", "max": 10, "kp": 0.02},
+			map[string]interface{}{"name": "summer", "min": 25, "kp": 0.2},
+		},
+	})
+	input := func(at time.Time, temp float64, ambient float64) Input {
+		return Input{Time: at, Measurements: map[string]Measurement{
+			PrimaryInput: {Time: at, Value: temp},
+			"ambient":    {Time: at, Value: ambient},
+		}}
+	}
+
+	output, err := strategy.Demand(input(now, 45, 0))
+	assert.NoError(t, err)
+	assert.Equal(t, "winter", output.Diagnostics["pid_gain_set"])
+	assert.InDelta(t, 0.1, output.Level, 0.0001)
+
+	// Nothing matches between the bands, so the top level gains are used
+	output, err = strategy.Demand(input(now.Add(time.Second), 45, 15))
+	assert.NoError(t, err)
+	assert.Equal(t, "default", output.Diagnostics["pid_gain_set"])
+
+	_, err = strategy.Demand(Input{Time: now, Measurements: map[string]Measurement{PrimaryInput: {Time: now, Value: 45}}})
+	assert.ErrorContains(t, err, "ambient")
+}
+
+func TestPIDBumplessTransfer(t *testing.T) {
+	now := time.Now()
+	strategy := testScheduledPID(t, map[string]interface{}{
+		"on": "error",
+		"sets": []interface{}{
+			map[string]interface{}{"name": "near", "max": 5, "kp": 0.05, "ki": 0.001},
+			map[string]interface{}{"name": "far", "min": 5, "kp": 0.2, "ki": 0.001},
+		},
+	})
+	input := func(at time.Time, temp float64) Input {
+		return Input{Time: at, Measurements: map[string]Measurement{PrimaryInput: {Time: at, Value: temp}}}
+	}
+
+	output, err := strategy.Demand(input(now, 44))
+	assert.NoError(t, err)
+	assert.Equal(t, "near", output.Diagnostics["pid_gain_set"])
+	assert.InDelta(t, 0.2, output.Level, 0.0001)
+
+	// Crossing into the far band quadruples kp, but the output only moves by the step in temperature
+	before := output.Level
+	output, err = strategy.Demand(input(now.Add(time.Second), 45))
+	assert.NoError(t, err)
+	assert.Equal(t, "far", output.Diagnostics["pid_gain_set"])
+	assert.InDelta(t, before, output.Level, 0.01)
+
+	// From there the new gains take over
+	output, err = strategy.Demand(input(now.Add(2*time.Second), 46))
+	assert.NoError(t, err)
+	assert.InDelta(t, before+0.2, output.Level, 0.02)
+}
+
+func TestPIDScheduleValidation(t *testing.T) {
+	tests := []struct {
+		name     string
+		schedule map[string]interface{}
+		err      string
+	}{
+		{
+			name:     "unknown on",
+			schedule: map[string]interface{}{"on": "humidity", "sets": []interface{}{map[string]interface{}{"name": "a", "kp": 1}}},
+			err:      "pid.schedule.on",
+		},
+		{
+			name:     "no sets",
+			schedule: map[string]interface{}{"on": "duty"},
+			err:      "pid.schedule.sets",
+		},
+		{
+			name:     "reserved name",
+			schedule: map[string]interface{}{"on": "duty", "sets": []interface{}{map[string]interface{}{"name": "default", "kp": 1}}},
+			err:      "default is already in use",
+		},
+		{
+			name:     "empty range",
+			schedule: map[string]interface{}{"on": "duty", "sets": []interface{}{map[string]interface{}{"name": "a", "min": 50, "max": 50, "kp": 1}}},
+			err:      "pid.schedule.sets[0].max",
+		},
+		{
+			name:     "no gains",
+			schedule: map[string]interface{}{"on": "duty", "sets": []interface{}{map[string]interface{}{"name": "a"}}},
+			err:      "pid.schedule.sets[0]",
+		},
+		{
+			name:     "input without ambient",
+			schedule: map[string]interface{}{"on": "error", "input": "outside", "sets": []interface{}{map[string]interface{}{"name": "a", "kp": 1}}},
+			err:      "pid.schedule.input",
+		},
+		{
+			name:     "input not configured",
+			schedule: map[string]interface{}{"on": "ambient", "input": "outside", "sets": []interface{}{map[string]interface{}{"name": "a", "kp": 1}}},
+			err:      "there is no input named outside",
+		},
+		{
+			name:     "default input not configured",
+			schedule: map[string]interface{}{"on": "ambient", "sets": []interface{}{map[string]interface{}{"name": "a", "kp": 1}}},
+			err:      "there is no input named ambient",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pid := map[string]interface{}{"setpoint": 40, "kp": 0.1, "schedule": tt.schedule}
+			_, _, err := NewStrategy(StrategyPID, StrategyConfig{Path: "fan", Attributes: map[string]interface{}{"pid": pid}, Inputs: []string{PrimaryInput}})
+			assert.ErrorContains(t, err, tt.err)
+		})
+	}
+}
+
+func TestPIDHeating(t *testing.T) {
+	pid := &PID{Setpoint: 20, Kp: 0.1, Direction: DirectionHeating}
+	now := time.Now()
+	assert.Equal(t, 0.0, pid.update(now, 25))
+	assert.InDelta(t, 0.5, pid.update(now.Add(time.Second), 15), 0.0001)
+	assert.Equal(t, 1.0, pid.update(now.Add(2*time.Second), 0))
+}
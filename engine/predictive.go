@@ -0,0 +1,182 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rinzlerlabs/viam-fan-controller/utils"
+)
+
+const StrategyPredictive = "predictive"
+
+const (
+	defaultHorizon       = 60 * time.Second
+	defaultSamplePeriod  = 5 * time.Second
+	defaultPlantHistory  = time.Hour
+	defaultMaxDeadTime   = 5 * time.Minute
+	defaultRefitInterval = time.Minute
+
+	CommandGetPlantModel = "get_plant_model"
+	CommandFitPlantModel = "fit_plant_model"
+)
+
+func init() {
+	RegisterStrategy(StrategyPredictive, newPredictive)
+}
+
+type predictiveConfig struct {
+	// The strategy that runs on the predicted temperature, with the same attributes
+	Base         string `json:"base"`
+	Horizon      int64  `json:"horizon"`
+	SamplePeriod int64  `json:"sample_period"`
+	History      int64  `json:"history"`
+	MaxDeadTime  int64  `json:"max_dead_time"`
+}
+
+// Predictive learns how the enclosure responds to the fans and hands another strategy the temperature it expects
+// horizon from now instead of the current one, so the fans get ahead of a change rather than chasing it. Until
+// there's enough history to fit a model, the base strategy gets the current temperature.
+type Predictive struct {
+	base    Strategy
+	horizon time.Duration
+	history *plantHistory
+	// What's being predicted, for the readings
+	quantity string
+}
+
+func newPredictive(conf StrategyConfig) (Strategy, []utils.ConfigWarning, error) {
+	var predictiveConf predictiveConfig
+	if err := DecodeAttributes(conf.Attributes, &predictiveConf); err != nil {
+		return nil, nil, utils.NewFieldError(conf.Path, "strategy_config", "%s", err)
+	}
+
+	if predictiveConf.Base == "" {
+		predictiveConf.Base = StrategyTable
+	}
+	if predictiveConf.Base == StrategyPredictive {
+		return nil, nil, utils.NewFieldError(conf.Path, "strategy_config.base", "cannot be %s", StrategyPredictive)
+	}
+	for field, seconds := range map[string]int64{
+		"horizon":       predictiveConf.Horizon,
+		"sample_period": predictiveConf.SamplePeriod,
+		"history":       predictiveConf.History,
+		"max_dead_time": predictiveConf.MaxDeadTime,
+	} {
+		if err := utils.ValidateDelay(conf.Path, "strategy_config."+field, seconds); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	p := &Predictive{horizon: defaultHorizon, quantity: defaultQuantity}
+	if conf.Quantity != "" {
+		p.quantity = conf.Quantity
+	}
+	if predictiveConf.Horizon > 0 {
+		p.horizon = time.Duration(predictiveConf.Horizon) * time.Second
+	}
+	period, history, maxDeadTime := defaultSamplePeriod, defaultPlantHistory, defaultMaxDeadTime
+	if predictiveConf.SamplePeriod > 0 {
+		period = time.Duration(predictiveConf.SamplePeriod) * time.Second
+	}
+	if predictiveConf.History > 0 {
+		history = time.Duration(predictiveConf.History) * time.Second
+	}
+	if predictiveConf.MaxDeadTime > 0 {
+		maxDeadTime = time.Duration(predictiveConf.MaxDeadTime) * time.Second
+	}
+	p.history = &plantHistory{
+		period:   period,
+		size:     int(history / period),
+		maxDelay: int(maxDeadTime / period),
+	}
+	if p.history.size-p.history.maxDelay <= minFitSamples {
+		return nil, nil, utils.NewFieldError(conf.Path, "strategy_config.history", "must hold at least %d samples more than max_dead_time, got %d", minFitSamples, p.history.size-p.history.maxDelay)
+	}
+
+	// Keep the history and the model, refitting from scratch would mean running blind for a while
+	var previousBase Strategy = conf.Previous
+	if previous, ok := conf.Previous.(*Predictive); ok {
+		previousBase = previous.base
+		p.history.samples = previous.history.samples
+		p.history.model = previous.history.model
+		p.history.lastFitTime = previous.history.lastFitTime
+		if len(p.history.samples) > p.history.size {
+			p.history.samples = p.history.samples[len(p.history.samples)-p.history.size:]
+		}
+	}
+
+	base, warnings, err := NewStrategy(predictiveConf.Base, StrategyConfig{Path: conf.Path, Attributes: conf.Attributes, Previous: previousBase, Inputs: conf.Inputs, Quantity: conf.Quantity})
+	if err != nil {
+		return nil, nil, err
+	}
+	p.base = base
+	return p, warnings, nil
+}
+
+func (p *Predictive) Demand(in Input) (Output, error) {
+	m := in.Primary()
+	p.history.record(m.Time, m.Value, in.State.Level)
+	if m.Time.Sub(p.history.lastFitTime) >= defaultRefitInterval {
+		p.history.fit(m.Time)
+	}
+
+	predicted := m.Value
+	if p.history.model != nil {
+		predicted = p.history.model.predict(p.history.samples, m.Value, in.State.Level, p.horizon)
+	}
+
+	measurements := make(map[string]Measurement, len(in.Measurements))
+	for name, measurement := range in.Measurements {
+		measurements[name] = measurement
+	}
+	measurements[PrimaryInput] = Measurement{Time: m.Time, Value: predicted}
+	output, err := p.base.Demand(Input{Time: in.Time, Measurements: measurements, State: in.State})
+	if err != nil {
+		return Output{}, err
+	}
+
+	diagnostics := map[string]interface{}{
+		"predicted_" + p.quantity: predicted,
+		"plant_model_fitted":      p.history.model != nil,
+	}
+	for key, value := range output.Diagnostics {
+		diagnostics[key] = value
+	}
+	output.Diagnostics = diagnostics
+	return output, nil
+}
+
+// DoCommand reports or refits the plant model, anything else goes to the base strategy
+func (p *Predictive) DoCommand(ctx context.Context, cmd map[string]interface{}) (map[string]interface{}, error) {
+	switch cmd["command"] {
+	case CommandGetPlantModel:
+		return p.modelResult(), nil
+	case CommandFitPlantModel:
+		if p.history.fit(time.Now()) == nil {
+			return nil, fmt.Errorf("could not fit a model to %d samples, the fans need to have changed speed while they were recorded", len(p.history.samples))
+		}
+		return p.modelResult(), nil
+	}
+	if commander, ok := p.base.(Commander); ok {
+		return commander.DoCommand(ctx, cmd)
+	}
+	return nil, fmt.Errorf("unknown command %v, must be one of %s or %s", cmd["command"], CommandGetPlantModel, CommandFitPlantModel)
+}
+
+func (p *Predictive) modelResult() map[string]interface{} {
+	result := map[string]interface{}{
+		"fitted":  p.history.model != nil,
+		"samples": len(p.history.samples),
+		"horizon": p.horizon.Seconds(),
+	}
+	if model := p.history.model; model != nil {
+		result["gain"] = model.Gain
+		result["time_constant"] = model.TimeConstant.Seconds()
+		result["dead_time"] = model.DeadTime.Seconds()
+		result["ambient"] = model.Ambient
+		result["rmse"] = model.RMSE
+		result["fitted_at"] = model.FittedAt.Format(time.RFC3339)
+	}
+	return result
+}
@@ -0,0 +1,135 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rinzlerlabs/viam-fan-controller/utils"
+)
+
+// The measurement every controller has, read from sensor_name and sensor_value_key
+const PrimaryInput = "primary"
+
+// Measurement is a single reading of one of the controller's inputs
+type Measurement struct {
+	Time  time.Time
+	Value float64
+}
+
+// State is what the fans are doing right now, as far as the actuator knows
+type State struct {
+	// From 0-1, on/off fans are either 0 or 1
+	Level float64
+	// When the fans last changed level, zero if the actuator doesn't track it
+	LastChange time.Time
+}
+
+// Input is everything a strategy gets to decide on
+type Input struct {
+	Time time.Time
+	// Keyed by input name, PrimaryInput is always there
+	Measurements map[string]Measurement
+	State        State
+}
+
+// Primary is the controller's main measurement
+func (in Input) Primary() Measurement {
+	return in.Measurements[PrimaryInput]
+}
+
+// Output is what a strategy decided
+type Output struct {
+	// From 0-1
+	Level float64
+	// Anything that explains the decision, it's added to the controller's readings
+	Diagnostics map[string]interface{}
+}
+
+// Strategy decides how hard the fans should run. Strategies are only ever called from the control loop, or through
+// Commander, with the controller's lock held, so they can keep whatever state they need between calls.
+type Strategy interface {
+	Demand(in Input) (Output, error)
+}
+
+// Commander is a strategy that takes commands through the controller's DoCommand
+type Commander interface {
+	DoCommand(ctx context.Context, cmd map[string]interface{}) (map[string]interface{}, error)
+}
+
+// StrategyConfig is what a strategy is built from
+type StrategyConfig struct {
+	// The controller's name, for errors and warnings
+	Path string
+	// The strategy's attributes, decode them with DecodeAttributes
+	Attributes map[string]interface{}
+	// The strategy running now, nil the first time. It may be a different strategy altogether.
+	Previous Strategy
+	// The measurements the strategy will be given, see InputNames
+	Inputs []string
+	// What the controller measures, anything the strategy reports about it is named after it. Empty is a temperature.
+	Quantity string
+}
+
+// RequireInput checks the strategy will be given the measurement name, field is where the strategy was told to use it
+func (conf StrategyConfig) RequireInput(field string, name string) error {
+	if !slices.Contains(conf.Inputs, name) {
+		return utils.NewFieldError(conf.Path, field, "there is no input named %s", name)
+	}
+	return nil
+}
+
+// StrategyFactory builds a strategy, it's also used to validate the config so it mustn't have side effects
+type StrategyFactory func(conf StrategyConfig) (Strategy, []utils.ConfigWarning, error)
+
+var (
+	strategiesMu sync.RWMutex
+	strategies   = make(map[string]StrategyFactory)
+)
+
+// RegisterStrategy makes a strategy available to every model under name, call it from an init function.
+// Registering the same name twice panics, the same as registering a resource model twice.
+func RegisterStrategy(name string, factory StrategyFactory) {
+	strategiesMu.Lock()
+	defer strategiesMu.Unlock()
+	if _, ok := strategies[name]; ok {
+		panic(fmt.Sprintf("strategy %s is already registered", name))
+	}
+	strategies[name] = factory
+}
+
+// Strategies is the name of every registered strategy, sorted
+func Strategies() []string {
+	strategiesMu.RLock()
+	defer strategiesMu.RUnlock()
+	names := make([]string, 0, len(strategies))
+	for name := range strategies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewStrategy builds the strategy registered under name
+func NewStrategy(name string, conf StrategyConfig) (Strategy, []utils.ConfigWarning, error) {
+	strategiesMu.RLock()
+	factory, ok := strategies[name]
+	strategiesMu.RUnlock()
+	if !ok {
+		return nil, nil, utils.NewFieldError(conf.Path, "strategy", "unknown strategy %s, must be one of %v", name, Strategies())
+	}
+	return factory(conf)
+}
+
+// DecodeAttributes fills target, a pointer to a struct with json tags, from a strategy's attributes
+func DecodeAttributes(attributes map[string]interface{}, target interface{}) error {
+	raw, err := json.Marshal(attributes)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, target)
+}
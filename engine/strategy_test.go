@@ -0,0 +1,72 @@
+package engine
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/rinzlerlabs/viam-fan-controller/utils"
+)
+
+// siteCurve stands in for a strategy registered from outside the module
+type siteCurve struct {
+	Gain float64 `json:"gain"`
+}
+
+func (s *siteCurve) Demand(in Input) (Output, error) {
+	return Output{Level: in.Primary().Value * s.Gain}, nil
+}
+
+func TestStrategyRegistry(t *testing.T) {
+	RegisterStrategy("test_site_curve", func(conf StrategyConfig) (Strategy, []utils.ConfigWarning, error) {
+		curve := &siteCurve{}
+		if err := DecodeAttributes(conf.Attributes, curve); err != nil {
+			return nil, nil, err
+		}
+		return curve, nil, nil
+	})
+	assert.Subset(t, Strategies(), []string{StrategyTable, StrategyHysteresis, StrategyPID, "test_site_curve"})
+
+	strategy, _, err := NewStrategy("test_site_curve", StrategyConfig{Path: "fan", Attributes: map[string]interface{}{"gain": 0.01}})
+	assert.NoError(t, err)
+	output, err := strategy.Demand(Input{Measurements: map[string]Measurement{PrimaryInput: {Time: time.Now(), Value: 50}}})
+	assert.NoError(t, err)
+	assert.Equal(t, 0.5, output.Level)
+
+	_, _, err = NewStrategy("nope", StrategyConfig{Path: "fan"})
+	assert.ErrorContains(t, err, "unknown strategy nope")
+
+	assert.Panics(t, func() { RegisterStrategy(StrategyTable, newTable) })
+}
+
+func TestBuiltInStrategies(t *testing.T) {
+	strategy, warnings, err := NewStrategy(StrategyTable, StrategyConfig{Path: "fan", Attributes: map[string]interface{}{
+		"temperature_table": map[string]float64{"30": 0.5, "50": 1},
+	}})
+	assert.NoError(t, err)
+	assert.Empty(t, warnings)
+	input := Input{Measurements: map[string]Measurement{PrimaryInput: {Value: 40}}}
+	output, err := strategy.Demand(input)
+	assert.NoError(t, err)
+	assert.Equal(t, 0.5, output.Level)
+
+	_, _, err = NewStrategy(StrategyTable, StrategyConfig{Path: "fan"})
+	assert.ErrorContains(t, err, "temperature_table")
+
+	strategy, _, err = NewStrategy(StrategyHysteresis, StrategyConfig{Path: "fan", Attributes: map[string]interface{}{
+		"on_temperature":  35.0,
+		"off_temperature": 30.0,
+	}})
+	assert.NoError(t, err)
+	output, err = strategy.Demand(input)
+	assert.NoError(t, err)
+	assert.Equal(t, 1.0, output.Level)
+
+	// Off has to be below on
+	_, _, err = NewStrategy(StrategyHysteresis, StrategyConfig{Path: "fan", Attributes: map[string]interface{}{
+		"on_temperature":  30.0,
+		"off_temperature": 30.0,
+	}})
+	assert.ErrorContains(t, err, "off_temperature")
+}
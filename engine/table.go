@@ -0,0 +1,124 @@
+package engine
+
+import (
+	"context"
+	"errors"
+
+	"go.viam.com/rdk/resource"
+
+	"github.com/rinzlerlabs/viam-fan-controller/utils"
+)
+
+const StrategyTable = "table"
+
+func init() {
+	RegisterStrategy(StrategyTable, newTable)
+}
+
+type tableConfig struct {
+	TemperatureTable map[string]float64 `json:"temperature_table"`
+	// The same thing, for quantities other than temperature
+	ValueTable map[string]float64 `json:"value_table"`
+	Adaptive   *adaptiveConfig    `json:"adaptive"`
+	Direction  string             `json:"direction"`
+}
+
+// Table runs the fans at the level for the hottest temperature in the table the measurement has reached, or the
+// coldest when heating. With adaptive set it learns the table's levels as it goes.
+type Table struct {
+	TemperatureTable map[float64]float64
+	// The table's temperatures, sorted from hottest to coldest
+	Temps     []float64
+	Direction Direction
+	adaptive  *adaptive
+}
+
+func newTable(conf StrategyConfig) (Strategy, []utils.ConfigWarning, error) {
+	var tableConf tableConfig
+	if err := DecodeAttributes(conf.Attributes, &tableConf); err != nil {
+		return nil, nil, utils.NewFieldError(conf.Path, "strategy_config", "%s", err)
+	}
+	field, raw := "temperature_table", tableConf.TemperatureTable
+	if tableConf.ValueTable != nil {
+		if raw != nil {
+			return nil, nil, utils.NewFieldError(conf.Path, "value_table", "cannot be combined with temperature_table")
+		}
+		field, raw = "value_table", tableConf.ValueTable
+	}
+	if raw == nil {
+		return nil, nil, resource.NewConfigValidationFieldRequiredError(conf.Path, field)
+	}
+
+	direction, err := ParseDirection(conf.Path, tableConf.Direction)
+	if err != nil {
+		return nil, nil, err
+	}
+	table, temps, warnings, err := utils.ParseTemperatureTable(conf.Path, field, raw, direction == DirectionHeating)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	t := &Table{TemperatureTable: table, Temps: temps, Direction: direction}
+	if tableConf.Adaptive != nil {
+		// The ceiling only makes sense for fans that bring the temperature down
+		if direction != DirectionCooling {
+			return nil, nil, utils.NewFieldError(conf.Path, "adaptive", "only works with direction %s", DirectionCooling)
+		}
+		learner, adaptiveWarnings, err := newAdaptive(conf.Path, tableConf.Adaptive, table)
+		if err != nil {
+			return nil, nil, err
+		}
+		warnings = append(warnings, adaptiveWarnings...)
+		previous, _ := conf.Previous.(*Table)
+		learner.restore(table, previous)
+		t.adaptive = learner
+	}
+	return t, warnings, nil
+}
+
+func (t *Table) Demand(in Input) (Output, error) {
+	m := in.Primary()
+	level, err := getDesiredSpeed(t.Direction, m.Value, t.Temps, t.TemperatureTable)
+	if err != nil {
+		return Output{}, err
+	}
+	if t.adaptive == nil {
+		return Output{Level: level}, nil
+	}
+
+	for _, point := range t.Temps {
+		if m.Value >= point {
+			if t.adaptive.observe(t, point, m) {
+				level = t.adaptive.MaxDuty
+			} else {
+				level = t.TemperatureTable[point]
+			}
+			break
+		}
+	}
+	return Output{Level: level, Diagnostics: t.adaptive.diagnostics(t)}, nil
+}
+
+// DoCommand reviews, exports or resets the learned table
+func (t *Table) DoCommand(ctx context.Context, cmd map[string]interface{}) (map[string]interface{}, error) {
+	if t.adaptive == nil {
+		return nil, errors.New("the table is not adaptive, there is nothing learned")
+	}
+	return t.adaptive.doCommand(ctx, t, cmd)
+}
+
+// getDesiredSpeed is the level for the first temperature in the table the current temperature has reached, working
+// from the hottest down when cooling and from the coldest up when heating
+func getDesiredSpeed(direction Direction, currentTemp float64, temps []float64, tempTable map[float64]float64) (float64, error) {
+	for i := range temps {
+		targetTemp := temps[i]
+		if direction == DirectionHeating {
+			targetTemp = temps[len(temps)-1-i]
+		}
+		if direction.reached(currentTemp, targetTemp) {
+			return tempTable[targetTemp], nil
+		}
+	}
+
+	return 0, errors.New("temperature not found in table")
+}
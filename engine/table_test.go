@@ -0,0 +1,204 @@
+package engine
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetDesiredSpeed(t *testing.T) {
+	tempTable := map[float64]float64{
+		0:   0,
+		30:  50,
+		40:  60,
+		50:  70,
+		60:  80,
+		100: 100,
+	}
+
+	temps := []float64{100, 60, 50, 40, 30}
+
+	tests := []struct {
+		name        string
+		currentTemp float64
+		want        float64
+		wantErr     bool
+	}{
+		{
+			name:        "Test 1",
+			currentTemp: 25,
+			want:        0,
+			wantErr:     true,
+		},
+		{
+			name:        "Test 2",
+			currentTemp: 35,
+			want:        50,
+			wantErr:     false,
+		},
+		{
+			name:        "Test 3",
+			currentTemp: 55,
+			want:        70,
+			wantErr:     false,
+		},
+		{
+			name:        "Test 4",
+			currentTemp: 70,
+			want:        80,
+			wantErr:     false,
+		},
+		{
+			name:        "Test 5",
+			currentTemp: 110,
+			want:        100,
+			wantErr:     false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := getDesiredSpeed(DirectionCooling, tt.currentTemp, temps, tempTable)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("getDesiredSpeed() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("getDesiredSpeed() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetDesiredSpeedHeating(t *testing.T) {
+	// Colder means faster, the fan moves warm air in
+	tempTable := map[float64]float64{
+		5:  100,
+		10: 60,
+		15: 30,
+		20: 0,
+	}
+
+	temps := []float64{20, 15, 10, 5}
+
+	tests := []struct {
+		name        string
+		currentTemp float64
+		want        float64
+		wantErr     bool
+	}{
+		{name: "Warmer than the table", currentTemp: 25, want: 0, wantErr: true},
+		{name: "At the warmest point", currentTemp: 20, want: 0},
+		{name: "Between points", currentTemp: 12, want: 30},
+		{name: "At a point", currentTemp: 10, want: 60},
+		{name: "Colder than the table", currentTemp: -5, want: 100},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := getDesiredSpeed(DirectionHeating, tt.currentTemp, temps, tempTable)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("getDesiredSpeed() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("getDesiredSpeed() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func newAdaptiveTable(t *testing.T, previous Strategy) *Table {
+	attributes := map[string]interface{}{
+		"temperature_table": map[string]float64{"30": 50, "40": 80},
+		"adaptive":          map[string]interface{}{"ceiling": 50, "min_duty": 20, "step": 10, "settle_time": 60},
+	}
+	strategy, _, err := NewStrategy(StrategyTable, StrategyConfig{Path: "fan", Attributes: attributes, Previous: previous})
+	assert.NoError(t, err)
+	return strategy.(*Table)
+}
+
+func TestAdaptiveTable(t *testing.T) {
+	dataDir := t.TempDir()
+	t.Setenv("VIAM_MODULE_DATA", dataDir)
+	ctx := context.Background()
+	now := time.Now()
+	input := func(at time.Time, temp float64) Input {
+		return Input{Time: at, Measurements: map[string]Measurement{PrimaryInput: {Time: at, Value: temp}}}
+	}
+	table := newAdaptiveTable(t, nil)
+
+	// Comfortably under the ceiling for a whole window, so the point is lowered a step
+	output, err := table.Demand(input(now, 35))
+	assert.NoError(t, err)
+	assert.Equal(t, 0.5, output.Level)
+	output, err = table.Demand(input(now.Add(time.Minute), 36))
+	assert.NoError(t, err)
+	assert.InDelta(t, 0.4, output.Level, 0.0001)
+	assert.Equal(t, 30.0, output.Diagnostics["learning_point"])
+
+	// Reaching the ceiling raises the point and runs flat out until it's back under
+	output, err = table.Demand(input(now.Add(2*time.Minute), 50))
+	assert.NoError(t, err)
+	assert.Equal(t, 1.0, output.Level)
+	assert.Equal(t, true, output.Diagnostics["over_ceiling"])
+	output, err = table.Demand(input(now.Add(2*time.Minute+time.Second), 45))
+	assert.NoError(t, err)
+	assert.InDelta(t, 0.9, output.Level, 0.0001)
+
+	// The learned table is saved, and picked up again after a restart
+	_, err = os.Stat(filepath.Join(dataDir, "fan-learned-table.json"))
+	assert.NoError(t, err)
+	restarted := newAdaptiveTable(t, nil)
+	exported, err := restarted.DoCommand(ctx, map[string]interface{}{"command": CommandExportTable})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"30": 40.0, "40": 90.0}, exported["temperature_table"])
+
+	learned, err := restarted.DoCommand(ctx, map[string]interface{}{"command": CommandGetLearnedTable})
+	assert.NoError(t, err)
+	assert.Len(t, learned["observations"].(map[string]interface{})["40"], 1)
+
+	// Resetting goes back to the configured table and forgets what was saved
+	_, err = restarted.DoCommand(ctx, map[string]interface{}{"command": CommandResetLearning})
+	assert.NoError(t, err)
+	assert.Equal(t, map[float64]float64{30: 0.5, 40: 0.8}, restarted.TemperatureTable)
+	_, err = os.Stat(filepath.Join(dataDir, "fan-learned-table.json"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestAdaptiveTableStaysInOrder(t *testing.T) {
+	t.Setenv("VIAM_MODULE_DATA", t.TempDir())
+	now := time.Now()
+	table := newAdaptiveTable(t, nil)
+	table.TemperatureTable[40] = 0.55
+
+	// The hot point can't be learned below the cool one, or below min_duty
+	for i := 0; i < 10; i++ {
+		at := now.Add(time.Duration(i) * time.Minute)
+		_, err := table.Demand(Input{Time: at, Measurements: map[string]Measurement{PrimaryInput: {Time: at, Value: 42}}})
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, 0.5, table.TemperatureTable[40])
+
+	// Reconfiguring keeps what was learned
+	assert.Equal(t, 0.5, newAdaptiveTable(t, table).TemperatureTable[40])
+}
+
+func TestTableValueAlias(t *testing.T) {
+	strategy, _, err := NewStrategy(StrategyTable, StrategyConfig{Path: "fan", Attributes: map[string]interface{}{"value_table": map[string]float64{"400": 0, "1000": 100}}})
+	assert.NoError(t, err)
+	assert.Equal(t, map[float64]float64{400: 0, 1000: 1}, strategy.(*Table).TemperatureTable)
+
+	_, _, err = NewStrategy(StrategyTable, StrategyConfig{Path: "fan", Attributes: map[string]interface{}{
+		"value_table":       map[string]float64{"400": 0},
+		"temperature_table": map[string]float64{"30": 0},
+	}})
+	assert.ErrorContains(t, err, "value_table")
+
+	_, _, err = NewStrategy(StrategyTable, StrategyConfig{Path: "fan", Attributes: map[string]interface{}{}})
+	assert.ErrorContains(t, err, "temperature_table")
+}
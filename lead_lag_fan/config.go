@@ -0,0 +1,114 @@
+package lead_lag_fan
+
+import (
+	"fmt"
+
+	"go.viam.com/rdk/resource"
+
+	"github.com/rinzlerlabs/viam-fan-controller/engine"
+	"github.com/rinzlerlabs/viam-fan-controller/utils"
+)
+
+const (
+	RotationModeRunHours = "run_hours"
+	RotationModeSchedule = "schedule"
+)
+
+type CloudConfig struct {
+	engine.LoopAttributes `json:",squash"`
+	BoardName             string      `json:"board_name"`
+	Fans                  []FanConfig `json:"fans"`
+	OnTemperature         *float64    `json:"on_temperature"`
+	OffTemperature        *float64    `json:"off_temperature"`
+	OnDelay               int64       `json:"on_delay"`
+	OffDelay              int64       `json:"off_delay"`
+	LagTemperature        float64     `json:"lag_temperature"`
+	LagOffTemperature     float64     `json:"lag_off_temperature"`
+	LagDelay              int64       `json:"lag_delay"`
+	RotationMode          string      `json:"rotation_mode"`
+	RotationHours         float64     `json:"rotation_hours"`
+}
+
+// FanConfig is a single fan in the group, the optional fault pin reads high when the fan has failed
+type FanConfig struct {
+	FanPin   string `json:"fan_pin"`
+	FaultPin string `json:"fault_pin"`
+}
+
+func (conf *CloudConfig) Validate(path string) ([]string, error) {
+	deps, _, err := conf.validate(path)
+	return deps, err
+}
+
+// validate does all the range checking, and also returns warnings for anything legal but suspicious
+func (conf *CloudConfig) validate(path string) ([]string, []utils.ConfigWarning, error) {
+	warnings := []utils.ConfigWarning{}
+	if conf.BoardName == "" {
+		return nil, nil, resource.NewConfigValidationFieldRequiredError(path, "board_name")
+	}
+
+	if len(conf.Fans) < 2 {
+		return nil, nil, utils.NewFieldError(path, "fans", "requires at least 2 fans, got %d", len(conf.Fans))
+	}
+
+	seen := make(map[string]bool)
+	for i, fan := range conf.Fans {
+		field := fmt.Sprintf("fans[%d]", i)
+		if fan.FanPin == "" {
+			return nil, nil, resource.NewConfigValidationFieldRequiredError(path, field+".fan_pin")
+		}
+		if seen[fan.FanPin] {
+			return nil, nil, utils.NewFieldError(path, field+".fan_pin", "%s is used by more than one fan", fan.FanPin)
+		}
+		seen[fan.FanPin] = true
+		if fan.FaultPin == fan.FanPin {
+			return nil, nil, utils.NewFieldError(path, field+".fault_pin", "cannot be the same as fan_pin")
+		}
+	}
+
+	if err := conf.LoopAttributes.Validate(path); err != nil {
+		return nil, nil, err
+	}
+
+	if conf.OnTemperature == nil {
+		return nil, nil, resource.NewConfigValidationFieldRequiredError(path, "on_temperature")
+	}
+
+	if conf.OffTemperature == nil {
+		return nil, nil, resource.NewConfigValidationFieldRequiredError(path, "off_temperature")
+	}
+
+	if *conf.OffTemperature >= *conf.OnTemperature {
+		return nil, nil, utils.NewFieldError(path, "off_temperature", "must be less than on_temperature %v, got %v", *conf.OnTemperature, *conf.OffTemperature)
+	}
+
+	if conf.LagTemperature != 0 && conf.LagOffTemperature != 0 && conf.LagOffTemperature >= conf.LagTemperature {
+		return nil, nil, utils.NewFieldError(path, "lag_off_temperature", "must be less than lag_temperature %v, got %v", conf.LagTemperature, conf.LagOffTemperature)
+	}
+
+	if conf.LagTemperature != 0 && conf.LagTemperature < *conf.OnTemperature {
+		warnings = append(warnings, utils.NewConfigWarning(path, "lag_temperature", "is below on_temperature, the lag fan will start whenever the lead fan has run for lag_delay"))
+	}
+
+	for field, delay := range map[string]int64{"on_delay": conf.OnDelay, "off_delay": conf.OffDelay, "lag_delay": conf.LagDelay} {
+		if err := utils.ValidateDelay(path, field, delay); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	switch conf.RotationMode {
+	case "", RotationModeRunHours, RotationModeSchedule:
+	default:
+		return nil, nil, utils.NewFieldError(path, "rotation_mode", "unknown rotation mode %s", conf.RotationMode)
+	}
+
+	if conf.RotationHours < 0 {
+		return nil, nil, utils.NewFieldError(path, "rotation_hours", "cannot be negative, got %v", conf.RotationHours)
+	}
+
+	if conf.RotationHours > 0 && conf.RotationHours < 1 {
+		warnings = append(warnings, utils.NewConfigWarning(path, "rotation_hours", "is less than an hour, the fans will hand off very often"))
+	}
+
+	return []string{conf.BoardName, conf.SensorName}, warnings, nil
+}
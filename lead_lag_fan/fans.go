@@ -0,0 +1,232 @@
+package lead_lag_fan
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"go.viam.com/rdk/components/board"
+	"go.viam.com/rdk/logging"
+
+	"github.com/rinzlerlabs/viam-fan-controller/engine"
+	"github.com/rinzlerlabs/viam-fan-controller/utils"
+)
+
+// How often the run hours are written to disk
+const saveInterval = time.Minute
+
+// Levels come from dividing by the number of fans, this keeps 2/3 of 3 fans from rounding up to the third
+const levelTolerance = 1e-9
+
+// Fan is a single fan in the group
+type Fan struct {
+	FanPin       board.GPIOPin
+	FanPinName   string
+	claim        utils.Output
+	FaultPin     board.GPIOPin
+	FaultPinName string
+	// Set when the last write to the fan pin failed, cleared when a write succeeds
+	pinFault bool
+}
+
+// leadLag runs a share of the group's fans, the level is the number running over the number of fans. Which fans
+// run is up to the lead rotation, and the run hours it keeps are saved to statePath.
+type leadLag struct {
+	fans      []*Fan
+	group     *fanGroup
+	statePath string
+	logger    logging.Logger
+	// How many fans were last asked for
+	needed   int
+	lastTick time.Time
+	lastSave time.Time
+}
+
+// fansFor is how many fans to run at level, any level at all runs at least the lead fan
+func (l *leadLag) fansFor(level float64) int {
+	needed := int(math.Ceil(level*float64(len(l.fans)) - levelTolerance))
+	return max(0, min(needed, len(l.fans)))
+}
+
+// Apply runs one tick of the group, counting run hours and rotating the lead before picking the fans to run
+func (l *leadLag) Apply(ctx context.Context, now time.Time, level float64) error {
+	l.needed = l.fansFor(level)
+	running, err := l.running(ctx)
+	if err != nil {
+		return fmt.Errorf("error getting fan states: %w", err)
+	}
+	faulted := l.faulted(ctx)
+
+	if !l.lastTick.IsZero() {
+		l.group.accumulate(now.Sub(l.lastTick), running)
+	}
+	l.lastTick = now
+
+	if l.group.rotateIfDue(now, faulted) {
+		l.logger.Infof("Rotating lead fan to pin %s", l.fans[l.group.Lead].FanPinName)
+	}
+	desired := l.group.desiredStates(l.needed, faulted)
+
+	// Start fans before stopping any, so a hand off between fans never leaves the group with nothing running
+	var errs []error
+	for _, turnOn := range []bool{true, false} {
+		for i, fan := range l.fans {
+			if desired[i] != turnOn || running[i] == turnOn {
+				continue
+			}
+			l.logger.Infof("Turning fan on pin %s %s", fan.FanPinName, onOff(turnOn))
+			if err := fan.FanPin.Set(ctx, turnOn, nil); err != nil {
+				errs = append(errs, fmt.Errorf("error setting fan on pin %s: %w", fan.FanPinName, err))
+				fan.pinFault = true
+				continue
+			}
+			fan.pinFault = false
+		}
+	}
+
+	if l.statePath != "" && now.Sub(l.lastSave) >= saveInterval {
+		l.saveState()
+		l.lastSave = now
+	}
+	return errors.Join(errs...)
+}
+
+// Force sets every fan at once, any level at all runs at least the lead fan and the rest come on in proportion in
+// rotation order
+func (l *leadLag) Force(ctx context.Context, level float64) error {
+	l.needed = l.fansFor(level)
+	var errs []error
+	for i := range l.fans {
+		fan := l.fans[(l.group.Lead+i)%len(l.fans)]
+		if err := fan.FanPin.Set(ctx, i < l.needed, nil); err != nil {
+			errs = append(errs, fmt.Errorf("fan pin %s: %w", fan.FanPinName, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (l *leadLag) State(ctx context.Context) (engine.State, error) {
+	running, err := l.running(ctx)
+	if err != nil {
+		return engine.State{}, err
+	}
+	count := 0
+	for _, isRunning := range running {
+		if isRunning {
+			count++
+		}
+	}
+	return engine.State{Level: float64(count) / float64(len(l.fans))}, nil
+}
+
+// Outputs is the fan pins, fault pins are only read so they can be shared
+func (l *leadLag) Outputs() []utils.Output {
+	outputs := make([]utils.Output, 0, len(l.fans))
+	for _, fan := range l.fans {
+		outputs = append(outputs, fan.claim)
+	}
+	return outputs
+}
+
+func (l *leadLag) Stop(ctx context.Context, outputs []utils.Output) error {
+	var errs []error
+	for _, fan := range l.fans {
+		if !utils.IsReleased(outputs, fan.claim) {
+			continue
+		}
+		if err := fan.FanPin.Set(ctx, false, nil); err != nil {
+			errs = append(errs, fmt.Errorf("error turning off %s: %w", fan.claim, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (l *leadLag) Readings(ctx context.Context) (map[string]interface{}, error) {
+	running, err := l.running(ctx)
+	if err != nil {
+		return nil, err
+	}
+	faulted := l.faulted(ctx)
+
+	runningPins := make([]interface{}, 0, len(l.fans))
+	faultedPins := make([]interface{}, 0, len(l.fans))
+	runHours := make(map[string]interface{}, len(l.fans))
+	for i, fan := range l.fans {
+		if running[i] {
+			runningPins = append(runningPins, fan.FanPinName)
+		}
+		if faulted[i] {
+			faultedPins = append(faultedPins, fan.FanPinName)
+		}
+		runHours[fan.FanPinName] = l.group.RunTime[i].Hours()
+	}
+
+	return map[string]interface{}{
+		"lead_fan":     l.fans[l.group.Lead].FanPinName,
+		"lag_active":   l.needed > 1,
+		"running_fans": runningPins,
+		"faulted_fans": faultedPins,
+		"run_hours":    runHours,
+	}, nil
+}
+
+// Close saves the run hours, so the wear leveling picks up where it left off
+func (l *leadLag) Close(ctx context.Context) error {
+	if l.statePath != "" {
+		l.saveState()
+	}
+	return nil
+}
+
+func (l *leadLag) running(ctx context.Context) ([]bool, error) {
+	running := make([]bool, len(l.fans))
+	for i, fan := range l.fans {
+		isRunning, err := fan.FanPin.Get(ctx, nil)
+		if err != nil {
+			return nil, err
+		}
+		running[i] = isRunning
+	}
+	return running, nil
+}
+
+// faulted treats a fan as faulted if its fault pin is high, the fault pin can't be read, or the fan pin can't be written
+func (l *leadLag) faulted(ctx context.Context) []bool {
+	faulted := make([]bool, len(l.fans))
+	for i, fan := range l.fans {
+		faulted[i] = fan.pinFault
+		if fan.FaultPin == nil {
+			continue
+		}
+		isFaulted, err := fan.FaultPin.Get(ctx, nil)
+		if err != nil {
+			l.logger.Errorf("Error reading fault pin %s: %s", fan.FaultPinName, err)
+			isFaulted = true
+		}
+		faulted[i] = faulted[i] || isFaulted
+	}
+	return faulted
+}
+
+func (l *leadLag) saveState() {
+	if err := saveGroupState(l.statePath, l.group.state(l.pins())); err != nil {
+		l.logger.Errorf("Error saving run hours: %s", err)
+	}
+}
+
+func (l *leadLag) pins() []string {
+	pins := make([]string, len(l.fans))
+	for i, fan := range l.fans {
+		pins[i] = fan.FanPinName
+	}
+	return pins
+}
+
+func onOff(on bool) string {
+	if on {
+		return "on"
+	}
+	return "off"
+}
@@ -0,0 +1,220 @@
+package lead_lag_fan
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/rinzlerlabs/viam-fan-controller/engine"
+)
+
+// How long the lead fan holds its role before rotating if not configured
+const defaultRotationInterval = 24 * time.Hour
+
+// groupDemand is the lead/lag state machine, it decides how many fans the group needs. Needed is 0 when the group
+// is off, 1 when only the lead fan is needed and 2 when the lag fan is needed as well.
+type groupDemand struct {
+	OnTemperature     float64
+	OffTemperature    float64
+	LagTemperature    float64
+	LagOffTemperature float64
+	OnDelay           time.Duration
+	OffDelay          time.Duration
+	LagDelay          time.Duration
+	Fans              int
+	Needed            int
+	LastChange        time.Time
+}
+
+// Demand asks for the share of the group's fans that are needed, the group picks which ones
+func (d *groupDemand) Demand(in engine.Input) (engine.Output, error) {
+	d.updateDemand(in.Time, in.Primary().Value)
+	return engine.Output{Level: float64(d.Needed) / float64(d.Fans)}, nil
+}
+
+// updateDemand applies the on/off hysteresis for the group, and brings in the lag fan when the lead fan
+// has been running for the lag delay and still can't get the temperature under the lag temperature
+func (d *groupDemand) updateDemand(now time.Time, currentTemp float64) {
+	sinceChange := now.Sub(d.LastChange)
+	needed := d.Needed
+	switch d.Needed {
+	case 0:
+		if currentTemp >= d.OnTemperature && sinceChange >= d.OnDelay {
+			needed = 1
+		}
+	case 1:
+		if currentTemp < d.OffTemperature && sinceChange >= d.OffDelay {
+			needed = 0
+		} else if currentTemp >= d.LagTemperature && sinceChange >= d.LagDelay {
+			needed = 2
+		}
+	case 2:
+		if currentTemp < d.LagOffTemperature {
+			needed = 1
+		}
+	}
+
+	if needed != d.Needed {
+		d.Needed = needed
+		d.LastChange = now
+	}
+}
+
+// fanGroup is the lead rotation, it decides which fans run and keeps their run hours even
+type fanGroup struct {
+	RotationMode     string
+	RotationInterval time.Duration
+	Lead             int
+	LastRotation     time.Time
+	LeadRunTime      time.Duration
+	RunTime          []time.Duration
+}
+
+// accumulate adds run time to every fan that was running over the last tick
+func (g *fanGroup) accumulate(elapsed time.Duration, running []bool) {
+	for i, isRunning := range running {
+		if !isRunning {
+			continue
+		}
+		g.RunTime[i] += elapsed
+		if i == g.Lead {
+			g.LeadRunTime += elapsed
+		}
+	}
+}
+
+// rotateIfDue hands the lead role to the next healthy fan once the lead has run long enough, or on a schedule
+func (g *fanGroup) rotateIfDue(now time.Time, faulted []bool) bool {
+	if g.LastRotation.IsZero() {
+		g.LastRotation = now
+	}
+
+	interval := g.RotationInterval
+	if interval == 0 {
+		interval = defaultRotationInterval
+	}
+
+	due := false
+	switch g.RotationMode {
+	case RotationModeSchedule:
+		due = now.Sub(g.LastRotation) >= interval
+	default:
+		due = g.LeadRunTime >= interval
+	}
+	if !due {
+		return false
+	}
+
+	next := g.nextHealthy(g.Lead, faulted)
+	if next == g.Lead {
+		return false
+	}
+	g.Lead = next
+	g.LeadRunTime = 0
+	g.LastRotation = now
+	return true
+}
+
+func (g *fanGroup) nextHealthy(from int, faulted []bool) int {
+	for offset := 1; offset < len(g.RunTime); offset++ {
+		i := (from + offset) % len(g.RunTime)
+		if !faulted[i] {
+			return i
+		}
+	}
+	return from
+}
+
+// desiredStates picks which of the fans should be running to run needed of them, starting from the lead and skipping
+// any that have faulted, so a faulted lead fan is covered by the lag fan
+func (g *fanGroup) desiredStates(needed int, faulted []bool) []bool {
+	desired := make([]bool, len(g.RunTime))
+	for offset := 0; offset < len(g.RunTime) && needed > 0; offset++ {
+		i := (g.Lead + offset) % len(g.RunTime)
+		if faulted[i] {
+			continue
+		}
+		desired[i] = true
+		needed--
+	}
+	return desired
+}
+
+// leastRun is the fan with the fewest run hours, used to pick the first lead fan
+func (g *fanGroup) leastRun() int {
+	least := 0
+	for i, runTime := range g.RunTime {
+		if runTime < g.RunTime[least] {
+			least = i
+		}
+	}
+	return least
+}
+
+// groupState is what survives a restart so wear leveling isn't lost. The lead's progress towards its next rotation
+// is kept too, otherwise a fan that restarts more often than the rotation interval would never hand off.
+type groupState struct {
+	LeadPin      string             `json:"lead_pin"`
+	RunHours     map[string]float64 `json:"run_hours"`
+	LeadRunHours float64            `json:"lead_run_hours"`
+	LastRotation time.Time          `json:"last_rotation"`
+}
+
+// state is the group's state to save, with the fans named by their pins
+func (g *fanGroup) state(pins []string) *groupState {
+	runHours := make(map[string]float64, len(pins))
+	for i, pin := range pins {
+		runHours[pin] = g.RunTime[i].Hours()
+	}
+	return &groupState{
+		LeadPin:      pins[g.Lead],
+		RunHours:     runHours,
+		LeadRunHours: g.LeadRunTime.Hours(),
+		LastRotation: g.LastRotation,
+	}
+}
+
+// restore picks up from a saved state, matching fans by pin. If the lead fan is gone the fan with the fewest run
+// hours takes over with a fresh rotation interval.
+func (g *fanGroup) restore(pins []string, state *groupState) {
+	g.Lead = -1
+	for i, pin := range pins {
+		if state != nil {
+			g.RunTime[i] = time.Duration(state.RunHours[pin] * float64(time.Hour))
+			if pin == state.LeadPin {
+				g.Lead = i
+			}
+		}
+	}
+	if g.Lead < 0 {
+		g.Lead = g.leastRun()
+		return
+	}
+	g.LeadRunTime = time.Duration(state.LeadRunHours * float64(time.Hour))
+	g.LastRotation = state.LastRotation
+}
+
+func loadGroupState(path string) (*groupState, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	state := &groupState{}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+func saveGroupState(path string, state *groupState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	// Write then rename so a crash mid write never leaves a truncated state file behind
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,158 @@
+package lead_lag_fan
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/rinzlerlabs/viam-fan-controller/engine"
+)
+
+func newTestGroup(fans int) *fanGroup {
+	return &fanGroup{
+		RotationInterval: time.Hour,
+		RunTime:          make([]time.Duration, fans),
+	}
+}
+
+func TestUpdateDemand(t *testing.T) {
+	d := &groupDemand{
+		OnTemperature:     30,
+		OffTemperature:    25,
+		LagTemperature:    35,
+		LagOffTemperature: 32,
+		LagDelay:          time.Minute,
+		Fans:              2,
+	}
+	now := time.Now()
+
+	d.updateDemand(now, 28)
+	assert.Equal(t, 0, d.Needed)
+
+	d.updateDemand(now, 30)
+	assert.Equal(t, 1, d.Needed)
+
+	// The lead fan gets the lag delay to try to hold the temperature on its own
+	d.updateDemand(now.Add(30*time.Second), 40)
+	assert.Equal(t, 1, d.Needed)
+	d.updateDemand(now.Add(2*time.Minute), 40)
+	assert.Equal(t, 2, d.Needed)
+
+	// Lag drops out first, then the whole group
+	d.updateDemand(now.Add(3*time.Minute), 31)
+	assert.Equal(t, 1, d.Needed)
+	d.updateDemand(now.Add(4*time.Minute), 24)
+	assert.Equal(t, 0, d.Needed)
+}
+
+func TestDesiredStatesCoversFaultedLead(t *testing.T) {
+	g := newTestGroup(3)
+	g.Lead = 1
+
+	assert.Equal(t, []bool{false, true, false}, g.desiredStates(1, []bool{false, false, false}))
+
+	// Lead has faulted, the next fan picks up the load
+	assert.Equal(t, []bool{false, false, true}, g.desiredStates(1, []bool{false, true, false}))
+
+	// Lead and lag, wrapping around the group
+	g.Lead = 2
+	assert.Equal(t, []bool{true, false, true}, g.desiredStates(2, []bool{false, false, false}))
+
+	assert.Equal(t, []bool{false, false, false}, g.desiredStates(0, []bool{false, false, false}))
+}
+
+func TestLeadLagLevelsRoundTrip(t *testing.T) {
+	// Two of three fans is a level of 2/3, that has to come back as two fans and not three
+	l := &leadLag{fans: make([]*Fan, 3)}
+	d := &groupDemand{OnTemperature: 30, OffTemperature: 25, LagTemperature: 35, LagOffTemperature: 32, Fans: 3, Needed: 2}
+	out, err := d.Demand(engine.Input{Measurements: map[string]engine.Measurement{engine.PrimaryInput: {Value: 33}}})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, l.fansFor(out.Level))
+	assert.Equal(t, 0, l.fansFor(0))
+	assert.Equal(t, 1, l.fansFor(0.01))
+}
+
+func TestRotateOnRunHours(t *testing.T) {
+	g := newTestGroup(2)
+	now := time.Now()
+	healthy := []bool{false, false}
+
+	g.accumulate(30*time.Minute, []bool{true, false})
+	assert.False(t, g.rotateIfDue(now, healthy))
+
+	g.accumulate(31*time.Minute, []bool{true, false})
+	assert.True(t, g.rotateIfDue(now, healthy))
+	assert.Equal(t, 1, g.Lead)
+	assert.Equal(t, time.Duration(0), g.LeadRunTime)
+	assert.Equal(t, 61*time.Minute, g.RunTime[0])
+
+	// Never rotate onto a faulted fan
+	g.accumulate(2*time.Hour, []bool{false, true})
+	assert.False(t, g.rotateIfDue(now, []bool{true, false}))
+	assert.Equal(t, 1, g.Lead)
+}
+
+func TestRotateOnSchedule(t *testing.T) {
+	g := newTestGroup(2)
+	g.RotationMode = RotationModeSchedule
+	now := time.Now()
+	healthy := []bool{false, false}
+
+	// Rotates on wall clock time, whether or not the fans have been running
+	assert.False(t, g.rotateIfDue(now, healthy))
+	assert.False(t, g.rotateIfDue(now.Add(30*time.Minute), healthy))
+	assert.True(t, g.rotateIfDue(now.Add(time.Hour), healthy))
+	assert.Equal(t, 1, g.Lead)
+}
+
+func TestLeastRun(t *testing.T) {
+	g := newTestGroup(3)
+	g.RunTime = []time.Duration{5 * time.Hour, 2 * time.Hour, 3 * time.Hour}
+	assert.Equal(t, 1, g.leastRun())
+}
+
+func TestRotationSurvivesReconfigure(t *testing.T) {
+	pins := []string{"11", "13"}
+	now := time.Now()
+	healthy := []bool{false, false}
+
+	// Part way through the interval the group is rebuilt, the way a reconfigure or restart does
+	g := newTestGroup(2)
+	g.accumulate(40*time.Minute, []bool{true, false})
+	assert.False(t, g.rotateIfDue(now, healthy))
+	rebuilt := newTestGroup(2)
+	rebuilt.restore(pins, g.state(pins))
+
+	// The lead still hands off once it's run for the interval in total
+	rebuilt.accumulate(20*time.Minute, []bool{true, false})
+	assert.True(t, rebuilt.rotateIfDue(now.Add(20*time.Minute), healthy))
+	assert.Equal(t, 1, rebuilt.Lead)
+
+	// The same on a schedule, the interval runs from the last rotation and not the rebuild
+	g = newTestGroup(2)
+	g.RotationMode = RotationModeSchedule
+	assert.False(t, g.rotateIfDue(now, healthy))
+	rebuilt = newTestGroup(2)
+	rebuilt.RotationMode = RotationModeSchedule
+	rebuilt.restore(pins, g.state(pins))
+	assert.False(t, rebuilt.rotateIfDue(now.Add(40*time.Minute), healthy))
+	assert.True(t, rebuilt.rotateIfDue(now.Add(time.Hour), healthy))
+
+	// A lead that's no longer in the group starts the interval over on the fan with the fewest hours
+	rebuilt = newTestGroup(2)
+	rebuilt.restore([]string{"11", "15"}, &groupState{LeadPin: "13", RunHours: map[string]float64{"11": 5}, LeadRunHours: 0.9})
+	assert.Equal(t, 1, rebuilt.Lead)
+	assert.Equal(t, time.Duration(0), rebuilt.LeadRunTime)
+}
+
+func TestGroupStateRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	state := &groupState{LeadPin: "13", RunHours: map[string]float64{"11": 12.5, "13": 3}, LeadRunHours: 3, LastRotation: time.Now().UTC().Truncate(time.Second)}
+	assert.NoError(t, saveGroupState(path, state))
+
+	loaded, err := loadGroupState(path)
+	assert.NoError(t, err)
+	assert.Equal(t, state, loaded)
+}
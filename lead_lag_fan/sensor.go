@@ -0,0 +1,137 @@
+package lead_lag_fan
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"go.viam.com/rdk/components/board"
+	"go.viam.com/rdk/components/sensor"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/resource"
+
+	"github.com/rinzlerlabs/viam-fan-controller/engine"
+	"github.com/rinzlerlabs/viam-fan-controller/utils"
+)
+
+var (
+	Model       = resource.NewModel("rinzlerlabs", "fan", "leadlag")
+	API         = sensor.API
+	PrettyName  = "Lead/Lag Fan Controller"
+	Description = "A lead/lag fan group controller with wear leveling for Viam"
+	Version     = utils.Version
+)
+
+// What the lead/lag demand is called in readings
+const strategyName = "lead_lag"
+
+var controller = engine.Model{PrettyName: PrettyName, Build: build}
+
+func init() {
+	resource.RegisterComponent(
+		sensor.API,
+		Model,
+		resource.Registration[sensor.Sensor, *CloudConfig]{Constructor: NewSensor})
+}
+
+func NewSensor(ctx context.Context, deps resource.Dependencies, conf resource.Config, logger logging.Logger) (sensor.Sensor, error) {
+	return engine.New(ctx, deps, conf, logger, controller)
+}
+
+// build runs a group of redundant fans, rotating the lead between them and bringing in the lag fan when it's needed
+func build(ctx context.Context, deps resource.Dependencies, conf resource.Config, previous *engine.Settings, logger logging.Logger) (*engine.Settings, error) {
+	newConf, err := resource.NativeConfig[*CloudConfig](conf)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := engine.LogConfigWarnings(conf.ResourceName().ShortName(), newConf.validate, logger); err != nil {
+		return nil, err
+	}
+
+	fanBoard, err := board.FromDependencies(deps, newConf.BoardName)
+	if err != nil {
+		return nil, fmt.Errorf("error looking up board %s: %w", newConf.BoardName, err)
+	}
+
+	fans := make([]*Fan, 0, len(newConf.Fans))
+	for _, fanConf := range newConf.Fans {
+		fan := &Fan{FanPinName: fanConf.FanPin, FaultPinName: fanConf.FaultPin, claim: utils.GPIOOutput(newConf.BoardName, fanConf.FanPin)}
+		fan.FanPin, err = fanBoard.GPIOPinByName(fanConf.FanPin)
+		if err != nil {
+			return nil, fmt.Errorf("error looking up fan pin %s: %w", fanConf.FanPin, err)
+		}
+		if fanConf.FaultPin != "" {
+			fan.FaultPin, err = fanBoard.GPIOPinByName(fanConf.FaultPin)
+			if err != nil {
+				return nil, fmt.Errorf("error looking up fault pin %s: %w", fanConf.FaultPin, err)
+			}
+		}
+		fans = append(fans, fan)
+	}
+
+	demand := &groupDemand{
+		OnTemperature:     *newConf.OnTemperature,
+		OffTemperature:    *newConf.OffTemperature,
+		LagTemperature:    newConf.LagTemperature,
+		LagOffTemperature: newConf.LagOffTemperature,
+		OnDelay:           time.Duration(newConf.OnDelay * int64(time.Second)),
+		OffDelay:          time.Duration(newConf.OffDelay * int64(time.Second)),
+		LagDelay:          time.Duration(newConf.LagDelay * int64(time.Second)),
+		Fans:              len(fans),
+	}
+	if demand.LagTemperature == 0 {
+		demand.LagTemperature = demand.OnTemperature
+	}
+	if demand.LagOffTemperature == 0 {
+		demand.LagOffTemperature = demand.OffTemperature
+	}
+
+	group := &fanGroup{
+		RotationMode:     newConf.RotationMode,
+		RotationInterval: time.Duration(newConf.RotationHours * float64(time.Hour)),
+		RunTime:          make([]time.Duration, len(fans)),
+	}
+
+	// The module data directory is the only place we can count on being able to write to
+	statePath := ""
+	if dataDir := os.Getenv("VIAM_MODULE_DATA"); dataDir != "" {
+		statePath = filepath.Join(dataDir, conf.ResourceName().ShortName()+"-lead-lag.json")
+	}
+	fanGroupActuator := &leadLag{fans: fans, group: group, statePath: statePath, logger: logger}
+
+	// Carry the run hours and rotation over by pin name, from the running group if there is one, otherwise from disk
+	var state *groupState
+	var oldFans *leadLag
+	if previous != nil {
+		oldFans, _ = previous.Actuator.(*leadLag)
+		if oldDemand, ok := previous.Strategy.(*groupDemand); ok {
+			demand.Needed = min(oldDemand.Needed, len(fans))
+			demand.LastChange = oldDemand.LastChange
+		}
+	}
+	if oldFans != nil {
+		state = oldFans.group.state(oldFans.pins())
+		fanGroupActuator.needed = oldFans.needed
+		fanGroupActuator.lastTick = oldFans.lastTick
+		fanGroupActuator.lastSave = oldFans.lastSave
+	} else if statePath != "" {
+		state, err = loadGroupState(statePath)
+		if err != nil && !os.IsNotExist(err) {
+			logger.Warnf("Error loading run hours, starting from zero: %s", err)
+		}
+	}
+	group.restore(fanGroupActuator.pins(), state)
+
+	settings, err := engine.NewSettings(deps, conf.ResourceName().ShortName(), newConf.Common())
+	if err != nil {
+		return nil, err
+	}
+
+	settings.StrategyName = strategyName
+	settings.Strategy = demand
+	settings.Actuator = fanGroupActuator
+	return settings, nil
+}
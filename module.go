@@ -4,8 +4,11 @@ import (
 	"go.viam.com/rdk/module"
 	"go.viam.com/utils"
 
+	"github.com/rinzlerlabs/viam-fan-controller/lead_lag_fan"
+	"github.com/rinzlerlabs/viam-fan-controller/multi_speed_fan"
 	"github.com/rinzlerlabs/viam-fan-controller/on_off_fan"
 	"github.com/rinzlerlabs/viam-fan-controller/pwm_fan"
+	"github.com/rinzlerlabs/viam-fan-controller/staged_fan"
 
 	raspiutils "github.com/rinzlerlabs/viam-fan-controller/utils"
 	moduleutils "github.com/thegreatco/viamutils/module"
@@ -15,6 +18,11 @@ func main() {
 	logger := module.NewLoggerFromArgs(raspiutils.LoggerName)
 	logger.Infof("Starting RinzlerLabs Fan Controller Module %v", raspiutils.Version)
 	moduleutils.AddModularResource(on_off_fan.API, on_off_fan.Model)
+	moduleutils.AddModularResource(on_off_fan.MotorAPI, on_off_fan.Model)
 	moduleutils.AddModularResource(pwm_fan.API, pwm_fan.Model)
+	moduleutils.AddModularResource(pwm_fan.MotorAPI, pwm_fan.Model)
+	moduleutils.AddModularResource(multi_speed_fan.API, multi_speed_fan.Model)
+	moduleutils.AddModularResource(staged_fan.API, staged_fan.Model)
+	moduleutils.AddModularResource(lead_lag_fan.API, lead_lag_fan.Model)
 	utils.ContextualMain(moduleutils.RunModule, logger)
 }
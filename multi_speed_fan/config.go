@@ -0,0 +1,98 @@
+package multi_speed_fan
+
+import (
+	"fmt"
+	"time"
+
+	"go.viam.com/rdk/resource"
+
+	"github.com/rinzlerlabs/viam-fan-controller/engine"
+	"github.com/rinzlerlabs/viam-fan-controller/utils"
+)
+
+type CloudConfig struct {
+	engine.LoopAttributes `json:",squash"`
+	BoardName             string   `json:"board_name"`
+	FanPins               []string `json:"fan_pins"`
+	Stages                []Stage  `json:"stages"`
+	SwitchDelayMs         int64    `json:"switch_delay_ms"`
+}
+
+// Stage is the temperatures at which a single speed tap is selected and released
+type Stage struct {
+	OnTemperature  float64 `json:"on_temperature"`
+	OffTemperature float64 `json:"off_temperature"`
+}
+
+func (conf *CloudConfig) Validate(path string) ([]string, error) {
+	deps, _, err := conf.validate(path)
+	return deps, err
+}
+
+// validate does all the range checking, and also returns warnings for anything legal but suspicious
+func (conf *CloudConfig) validate(path string) ([]string, []utils.ConfigWarning, error) {
+	warnings := []utils.ConfigWarning{}
+	if conf.BoardName == "" {
+		return nil, nil, resource.NewConfigValidationFieldRequiredError(path, "board_name")
+	}
+
+	if len(conf.FanPins) == 0 {
+		return nil, nil, resource.NewConfigValidationFieldRequiredError(path, "fan_pins")
+	}
+
+	if err := conf.LoopAttributes.Validate(path); err != nil {
+		return nil, nil, err
+	}
+
+	loop, err := utils.ParseLoopSettings(path, conf.LoopConfig())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(conf.Stages) != len(conf.FanPins) {
+		return nil, nil, utils.NewFieldError(path, "stages", "must have one entry per fan pin, got %d stages for %d fan pins", len(conf.Stages), len(conf.FanPins))
+	}
+
+	seen := make(map[string]bool)
+	for i, pin := range conf.FanPins {
+		if pin == "" {
+			return nil, nil, resource.NewConfigValidationFieldRequiredError(path, fmt.Sprintf("fan_pins[%d]", i))
+		}
+		if seen[pin] {
+			return nil, nil, utils.NewFieldError(path, fmt.Sprintf("fan_pins[%d]", i), "%s is used more than once", pin)
+		}
+		seen[pin] = true
+	}
+
+	for i, stage := range conf.Stages {
+		if stage.OffTemperature >= stage.OnTemperature {
+			return nil, nil, utils.NewFieldError(path, fmt.Sprintf("stages[%d].off_temperature", i), "must be less than on_temperature %v, got %v", stage.OnTemperature, stage.OffTemperature)
+		}
+		if i == 0 {
+			continue
+		}
+		prev := conf.Stages[i-1]
+		if stage.OnTemperature <= prev.OnTemperature {
+			return nil, nil, utils.NewFieldError(path, fmt.Sprintf("stages[%d].on_temperature", i), "must be greater than stages[%d].on_temperature %v, got %v", i-1, prev.OnTemperature, stage.OnTemperature)
+		}
+		// Dropping out of this stage below where the one before it comes on would skip straight past it
+		if stage.OffTemperature < prev.OnTemperature {
+			warnings = append(warnings, utils.NewConfigWarning(path, fmt.Sprintf("stages[%d].off_temperature", i), "is below stages[%d].on_temperature, stepping down may skip straight past stage %d", i-1, i))
+		}
+	}
+
+	if conf.SwitchDelayMs < 0 {
+		return nil, nil, utils.NewFieldError(path, "switch_delay_ms", "cannot be negative, got %d", conf.SwitchDelayMs)
+	}
+
+	// Switching taps happens inside a single pass of the control loop, so it has to fit in one
+	if time.Duration(conf.SwitchDelayMs)*time.Millisecond >= loop.OperationTimeout {
+		return nil, nil, utils.NewFieldError(path, "switch_delay_ms", "must be shorter than operation_timeout %s, got %dms", loop.OperationTimeout, conf.SwitchDelayMs)
+	}
+
+	if conf.SwitchDelayMs > 0 && conf.SwitchDelayMs < 100 {
+		warnings = append(warnings, utils.NewConfigWarning(path, "switch_delay_ms", "is very short, most relays need at least 100ms to release"))
+	}
+
+	return []string{conf.BoardName, conf.SensorName}, warnings, nil
+}
@@ -0,0 +1,111 @@
+package multi_speed_fan
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"go.viam.com/rdk/components/board"
+	"go.viam.com/rdk/components/sensor"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/resource"
+
+	"github.com/rinzlerlabs/viam-fan-controller/engine"
+	"github.com/rinzlerlabs/viam-fan-controller/utils"
+)
+
+var (
+	Model       = resource.NewModel("rinzlerlabs", "fan", "multispeed")
+	API         = sensor.API
+	PrettyName  = "Multi-Speed Fan Controller"
+	Description = "A multi-speed relay fan controller for Viam"
+	Version     = utils.Version
+)
+
+// How long to wait between releasing one speed tap and energizing the next if not configured
+const defaultSwitchDelay = 500 * time.Millisecond
+
+// What the stage hysteresis is called in readings
+const strategyName = "stages"
+
+var controller = engine.Model{PrettyName: PrettyName, Build: build}
+
+func init() {
+	resource.RegisterComponent(
+		sensor.API,
+		Model,
+		resource.Registration[sensor.Sensor, *CloudConfig]{Constructor: NewSensor})
+}
+
+func NewSensor(ctx context.Context, deps resource.Dependencies, conf resource.Config, logger logging.Logger) (sensor.Sensor, error) {
+	return engine.New(ctx, deps, conf, logger, controller)
+}
+
+// build steps a single fan between its speed taps, one stage per tap
+func build(ctx context.Context, deps resource.Dependencies, conf resource.Config, previous *engine.Settings, logger logging.Logger) (*engine.Settings, error) {
+	newConf, err := resource.NativeConfig[*CloudConfig](conf)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := engine.LogConfigWarnings(conf.ResourceName().ShortName(), newConf.validate, logger); err != nil {
+		return nil, err
+	}
+
+	fanBoard, err := board.FromDependencies(deps, newConf.BoardName)
+	if err != nil {
+		return nil, fmt.Errorf("error looking up board %s: %w", newConf.BoardName, err)
+	}
+
+	fanTaps := &taps{names: newConf.FanPins, switchDelay: defaultSwitchDelay, logger: logger}
+	for _, pinName := range newConf.FanPins {
+		fanPin, err := fanBoard.GPIOPinByName(pinName)
+		if err != nil {
+			return nil, fmt.Errorf("error looking up fan pin %s: %w", pinName, err)
+		}
+		fanTaps.pins = append(fanTaps.pins, fanPin)
+		fanTaps.claims = append(fanTaps.claims, utils.GPIOOutput(newConf.BoardName, pinName))
+	}
+	if newConf.SwitchDelayMs > 0 {
+		fanTaps.switchDelay = time.Duration(newConf.SwitchDelayMs * int64(time.Millisecond))
+	}
+
+	settings, err := engine.NewSettings(deps, conf.ResourceName().ShortName(), newConf.Common())
+	if err != nil {
+		return nil, err
+	}
+
+	settings.StrategyName = strategyName
+	settings.Strategy = &stageHysteresis{stages: newConf.Stages}
+	settings.Actuator = fanTaps
+	return settings, nil
+}
+
+// stageHysteresis picks a speed tap from the temperature. The current stage comes from the taps themselves, so the
+// failsafe or a reconfigure moving the fan to another tap can't leave it out of step.
+type stageHysteresis struct {
+	stages []Stage
+}
+
+func (s *stageHysteresis) Demand(in engine.Input) (engine.Output, error) {
+	count := float64(len(s.stages))
+	current := int(math.Round(in.State.Level * count))
+	desired := getDesiredStage(in.Primary().Value, current, s.stages)
+	return engine.Output{Level: float64(desired) / count}, nil
+}
+
+// getDesiredStage steps up to the highest stage whose on temperature has been reached,
+// and only steps down once the temperature drops below the current stage's off temperature
+func getDesiredStage(currentTemp float64, currentStage int, stages []Stage) int {
+	for i := len(stages); i > currentStage; i-- {
+		if currentTemp >= stages[i-1].OnTemperature {
+			return i
+		}
+	}
+
+	for currentStage > 0 && currentTemp < stages[currentStage-1].OffTemperature {
+		currentStage--
+	}
+	return currentStage
+}
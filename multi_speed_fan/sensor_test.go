@@ -0,0 +1,155 @@
+package multi_speed_fan
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.viam.com/rdk/components/board"
+	"go.viam.com/rdk/logging"
+
+	"github.com/rinzlerlabs/viam-fan-controller/engine"
+)
+
+func TestGetDesiredStage(t *testing.T) {
+	stages := []Stage{
+		{OnTemperature: 30, OffTemperature: 25},
+		{OnTemperature: 40, OffTemperature: 35},
+		{OnTemperature: 50, OffTemperature: 45},
+	}
+
+	tests := []struct {
+		name         string
+		currentTemp  float64
+		currentStage int
+		want         int
+	}{
+		{name: "Cold and off stays off", currentTemp: 20, currentStage: 0, want: 0},
+		{name: "Between off and on temps stays off", currentTemp: 28, currentStage: 0, want: 0},
+		{name: "First stage on", currentTemp: 30, currentStage: 0, want: 1},
+		{name: "Jumps straight to the highest stage reached", currentTemp: 55, currentStage: 0, want: 3},
+		{name: "Hysteresis holds the current stage", currentTemp: 37, currentStage: 2, want: 2},
+		{name: "Steps down one stage", currentTemp: 34, currentStage: 2, want: 1},
+		{name: "Steps down several stages", currentTemp: 20, currentStage: 3, want: 0},
+		{name: "Steps down only as far as needed", currentTemp: 26, currentStage: 3, want: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, getDesiredStage(tt.currentTemp, tt.currentStage, stages))
+		})
+	}
+}
+
+// fakePin records every write into a shared log so we can check the ordering across pins
+type fakePin struct {
+	board.GPIOPin
+	name  string
+	high  bool
+	stuck bool
+	log   *[]string
+}
+
+func (p *fakePin) Set(ctx context.Context, high bool, extra map[string]interface{}) error {
+	*p.log = append(*p.log, fmt.Sprintf("%s=%t", p.name, high))
+	if !p.stuck {
+		p.high = high
+	}
+	return nil
+}
+
+func (p *fakePin) Get(ctx context.Context, extra map[string]interface{}) (bool, error) {
+	return p.high, nil
+}
+
+func newTestTaps(t *testing.T, log *[]string, names ...string) *taps {
+	fanTaps := &taps{names: names, logger: logging.NewTestLogger(t)}
+	for _, name := range names {
+		fanTaps.pins = append(fanTaps.pins, &fakePin{name: name, log: log})
+	}
+	return fanTaps
+}
+
+func TestSetStageBreakBeforeMake(t *testing.T) {
+	ctx := context.Background()
+	log := []string{}
+	fanTaps := newTestTaps(t, &log, "low", "medium", "high")
+
+	assert.NoError(t, fanTaps.setStage(ctx, 1))
+	assert.Equal(t, []string{"low=true"}, log)
+
+	// The old tap is released before the new one is energized
+	log = log[:0]
+	assert.NoError(t, fanTaps.setStage(ctx, 3))
+	assert.Equal(t, []string{"low=false", "high=true"}, log)
+	stage, err := fanTaps.currentStage(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, stage)
+
+	log = log[:0]
+	assert.NoError(t, fanTaps.setStage(ctx, 0))
+	assert.Equal(t, []string{"high=false"}, log)
+}
+
+func TestSetStageRefusesWhenTapIsStuck(t *testing.T) {
+	ctx := context.Background()
+	log := []string{}
+	fanTaps := newTestTaps(t, &log, "low", "high")
+
+	assert.NoError(t, fanTaps.setStage(ctx, 1))
+	fanTaps.pins[0].(*fakePin).stuck = true
+
+	// The low tap won't release, so the high tap must never be energized
+	assert.Error(t, fanTaps.setStage(ctx, 2))
+	high, _ := fanTaps.pins[1].Get(ctx, nil)
+	assert.False(t, high)
+}
+
+func TestCurrentStageDetectsMultipleTaps(t *testing.T) {
+	ctx := context.Background()
+	log := []string{}
+	fanTaps := newTestTaps(t, &log, "low", "high")
+	fanTaps.pins[0].(*fakePin).high = true
+	fanTaps.pins[1].(*fakePin).high = true
+
+	_, err := fanTaps.currentStage(ctx)
+	assert.Error(t, err)
+
+	// The next pass puts it right, even when it's already on the tap it wants
+	assert.NoError(t, fanTaps.Apply(ctx, time.Now(), 1))
+	stage, err := fanTaps.currentStage(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, stage)
+}
+
+func TestStagesFollowTheTaps(t *testing.T) {
+	ctx := context.Background()
+	log := []string{}
+	fanTaps := newTestTaps(t, &log, "low", "medium", "high")
+	strategy := &stageHysteresis{stages: []Stage{
+		{OnTemperature: 30, OffTemperature: 25},
+		{OnTemperature: 40, OffTemperature: 35},
+		{OnTemperature: 50, OffTemperature: 45},
+	}}
+	demand := func(temp float64) float64 {
+		state, err := fanTaps.State(ctx)
+		assert.NoError(t, err)
+		output, err := strategy.Demand(engine.Input{Measurements: map[string]engine.Measurement{engine.PrimaryInput: {Value: temp}}, State: state})
+		assert.NoError(t, err)
+		return output.Level
+	}
+
+	level := demand(42)
+	assert.NoError(t, fanTaps.Apply(ctx, time.Now(), level))
+	assert.Equal(t, 2, fanTaps.stageFor(level))
+	assert.Equal(t, "medium=true", log[len(log)-1])
+
+	// The failsafe jumps to the top tap, the stages carry on from there and step back down
+	assert.NoError(t, fanTaps.Force(ctx, 1))
+	level = demand(32)
+	assert.Equal(t, 1, fanTaps.stageFor(level))
+	assert.NoError(t, fanTaps.Apply(ctx, time.Now(), level))
+	assert.Equal(t, "low=true", log[len(log)-1])
+}
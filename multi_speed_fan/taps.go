@@ -0,0 +1,188 @@
+package multi_speed_fan
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"go.viam.com/rdk/components/board"
+	"go.viam.com/rdk/logging"
+
+	"github.com/rinzlerlabs/viam-fan-controller/engine"
+	"github.com/rinzlerlabs/viam-fan-controller/utils"
+)
+
+// Levels come from dividing by the number of taps, this keeps 2/3 of 3 taps from rounding up to the third
+const levelTolerance = 1e-9
+
+// taps selects one speed tap at a time with a relay per tap. Stage 0 is off, 1 is the first (slowest) fan pin,
+// and the level is the stage over the number of taps.
+type taps struct {
+	pins        []board.GPIOPin
+	names       []string
+	claims      []utils.Output
+	switchDelay time.Duration
+	logger      logging.Logger
+}
+
+// stageFor is the tap to run at level, any level at all runs at least the slowest tap
+func (t *taps) stageFor(level float64) int {
+	stage := int(math.Ceil(level*float64(len(t.pins)) - levelTolerance))
+	return max(0, min(stage, len(t.pins)))
+}
+
+func (t *taps) levelFor(stage int) float64 {
+	return float64(stage) / float64(len(t.pins))
+}
+
+// Apply switches to the tap for level, if more than one tap is somehow energized they're all put right
+func (t *taps) Apply(ctx context.Context, now time.Time, level float64) error {
+	desired := t.stageFor(level)
+	energized, err := t.energized(ctx)
+	if err != nil {
+		return fmt.Errorf("error getting fan stage: %w", err)
+	}
+	if len(energized) > 1 {
+		t.logger.Warnf("Stages %v are all energized, releasing everything but stage %d", energized, desired)
+	} else {
+		current := 0
+		if len(energized) == 1 {
+			current = energized[0]
+		}
+		if current == desired {
+			return nil
+		}
+		t.logger.Infof("Changing fan from stage %d to stage %d", current, desired)
+	}
+	if err := t.setStage(ctx, desired); err != nil {
+		return fmt.Errorf("error setting fan stage: %w", err)
+	}
+	return nil
+}
+
+func (t *taps) Force(ctx context.Context, level float64) error {
+	return t.setStage(ctx, t.stageFor(level))
+}
+
+// State is the energized tap. If there's more than one it's the fastest, Apply releases the others next.
+func (t *taps) State(ctx context.Context) (engine.State, error) {
+	energized, err := t.energized(ctx)
+	if err != nil {
+		return engine.State{}, err
+	}
+	stage := 0
+	if len(energized) > 0 {
+		stage = energized[len(energized)-1]
+	}
+	return engine.State{Level: t.levelFor(stage)}, nil
+}
+
+func (t *taps) Outputs() []utils.Output {
+	return t.claims
+}
+
+// Stop releases any tap that isn't ours any more, the engine does this before the new taps are driven,
+// so the motor is never on two taps
+func (t *taps) Stop(ctx context.Context, outputs []utils.Output) error {
+	for i, pin := range t.pins {
+		if !utils.IsReleased(outputs, t.claims[i]) {
+			continue
+		}
+		if err := pin.Set(ctx, false, nil); err != nil {
+			return fmt.Errorf("error turning off %s: %w", t.claims[i], err)
+		}
+	}
+	return nil
+}
+
+func (t *taps) Readings(ctx context.Context) (map[string]interface{}, error) {
+	stage, err := t.currentStage(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	activePin := ""
+	if stage > 0 {
+		activePin = t.names[stage-1]
+	}
+	return map[string]interface{}{
+		"stage":       stage,
+		"stage_count": len(t.pins),
+		"active_pin":  activePin,
+	}, nil
+}
+
+// setStage switches speed taps break-before-make, every other tap is released and confirmed off before the new one is energized
+func (t *taps) setStage(ctx context.Context, stage int) error {
+	wasEnergized := false
+	for i, pin := range t.pins {
+		if i+1 == stage {
+			continue
+		}
+		isHigh, err := pin.Get(ctx, nil)
+		if err != nil {
+			return err
+		}
+		if !isHigh {
+			continue
+		}
+		wasEnergized = true
+		if err := pin.Set(ctx, false, nil); err != nil {
+			return err
+		}
+		// Don't trust the write, make sure the tap is actually released before we go any further
+		isHigh, err = pin.Get(ctx, nil)
+		if err != nil {
+			return err
+		}
+		if isHigh {
+			return fmt.Errorf("fan pin %s did not release, refusing to energize another speed tap", t.names[i])
+		}
+	}
+
+	if stage == 0 {
+		return nil
+	}
+
+	// Give the relay contacts and the motor windings time to settle before switching to the new tap
+	if wasEnergized {
+		select {
+		case <-time.After(t.switchDelay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return t.pins[stage-1].Set(ctx, true, nil)
+}
+
+// energized reads back the fan pins to find which taps are energized, there should never be more than one
+func (t *taps) energized(ctx context.Context) ([]int, error) {
+	stages := []int{}
+	for i, pin := range t.pins {
+		isHigh, err := pin.Get(ctx, nil)
+		if err != nil {
+			return nil, err
+		}
+		if isHigh {
+			stages = append(stages, i+1)
+		}
+	}
+	return stages, nil
+}
+
+// currentStage is the energized tap, it's an error for more than one to be
+func (t *taps) currentStage(ctx context.Context) (int, error) {
+	energized, err := t.energized(ctx)
+	if err != nil {
+		return 0, err
+	}
+	switch len(energized) {
+	case 0:
+		return 0, nil
+	case 1:
+		return energized[0], nil
+	default:
+		return 0, fmt.Errorf("fan pins %s and %s are both energized", t.names[energized[0]-1], t.names[energized[1]-1])
+	}
+}
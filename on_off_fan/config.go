@@ -1,43 +1,196 @@
 package on_off_fan
 
-import "errors"
+import (
+	"go.viam.com/rdk/resource"
+
+	"github.com/rinzlerlabs/viam-fan-controller/engine"
+	"github.com/rinzlerlabs/viam-fan-controller/utils"
+)
 
 type CloudConfig struct {
-	BoardName        string  `json:"board_name"`
-	FanPin           string  `json:"fan_pin"`
-	SensorName       string  `json:"sensor_name"`
-	SensorValueKey   string  `json:"sensor_value_key"`
-	SensorValueRegex string  `json:"sensor_value_regex"`
-	OnTemperature    float64 `json:"on_temperature"`
-	OffTemperature   float64 `json:"off_temperature"`
-	OnDelay          int64   `json:"on_delay"`
-	OffDelay         int64   `json:"off_delay"`
+	engine.LoopAttributes `json:",squash"`
+	BoardName             string                 `json:"board_name"`
+	FanPin                string                 `json:"fan_pin"`
+	Quantity              string                 `json:"quantity"`
+	Unit                  string                 `json:"unit"`
+	OnTemperature         *float64               `json:"on_temperature"`
+	OffTemperature        *float64               `json:"off_temperature"`
+	OnValue               *float64               `json:"on_value"`
+	OffValue              *float64               `json:"off_value"`
+	OnDelay               int64                  `json:"on_delay"`
+	OffDelay              int64                  `json:"off_delay"`
+	OverrideDuration      int64                  `json:"override_duration"`
+	ControlMode           string                 `json:"control_mode"`
+	Strategy              string                 `json:"strategy"`
+	StrategyConfig        map[string]interface{} `json:"strategy_config"`
+	Inputs                []engine.InputConfig   `json:"inputs"`
+	Humidity              *engine.HumidityConfig `json:"humidity"`
+	CycleWindow           int64                  `json:"cycle_window"`
+	MaxCyclesPerHour      int                    `json:"max_cycles_per_hour"`
+	TemperatureTable      map[string]float64     `json:"temperature_table"`
+	ValueTable            map[string]float64     `json:"value_table"`
+	Direction             string                 `json:"direction"`
+	PID                   *engine.PIDConfig      `json:"pid"`
 }
 
 func (conf *CloudConfig) Validate(path string) ([]string, error) {
+	deps, _, err := conf.validate(path)
+	return deps, err
+}
+
+// validate does all the parsing and range checking, and also returns warnings for anything legal but suspicious
+func (conf *CloudConfig) validate(path string) ([]string, []utils.ConfigWarning, error) {
+	warnings := []utils.ConfigWarning{}
 	if conf.BoardName == "" {
-		return nil, errors.New("board_name is required")
+		return nil, nil, resource.NewConfigValidationFieldRequiredError(path, "board_name")
 	}
 
 	if conf.FanPin == "" {
-		return nil, errors.New("fan_pin is required")
+		return nil, nil, resource.NewConfigValidationFieldRequiredError(path, "fan_pin")
+	}
+
+	if err := conf.LoopAttributes.Validate(path); err != nil {
+		return nil, nil, err
+	}
+
+	if err := engine.ValidateQuantity(path, conf.Quantity); err != nil {
+		return nil, nil, err
+	}
+
+	if err := utils.ValidateDelay(path, "on_delay", conf.OnDelay); err != nil {
+		return nil, nil, err
+	}
+
+	if err := utils.ValidateDelay(path, "off_delay", conf.OffDelay); err != nil {
+		return nil, nil, err
+	}
+
+	switch conf.ControlMode {
+	case "", ControlModeOnOff:
+		if conf.CycleWindow != 0 || conf.MaxCyclesPerHour != 0 {
+			warnings = append(warnings, utils.NewConfigWarning(path, "control_mode", "cycle_window and max_cycles_per_hour only apply to time_proportional control"))
+		}
+	case ControlModeTimeProportional:
+		if conf.Strategy == "" && !conf.hasTable() && conf.PID == nil {
+			return nil, nil, utils.NewFieldError(path, "control_mode", "time_proportional requires temperature_table, value_table, pid or a strategy")
+		}
+
+		if conf.hasTable() && conf.PID != nil {
+			return nil, nil, utils.NewFieldError(path, "pid", "cannot be combined with temperature_table or value_table")
+		}
+
+		if err := utils.ValidateDelay(path, "cycle_window", conf.CycleWindow); err != nil {
+			return nil, nil, err
+		}
+
+		if conf.MaxCyclesPerHour < 0 {
+			return nil, nil, utils.NewFieldError(path, "max_cycles_per_hour", "cannot be negative, got %d", conf.MaxCyclesPerHour)
+		}
+
+		// Minimum on and off times longer than the window mean the fan can never cycle within it
+		if conf.CycleWindow > 0 && (conf.OnDelay >= conf.CycleWindow || conf.OffDelay >= conf.CycleWindow) {
+			warnings = append(warnings, utils.NewConfigWarning(path, "cycle_window", "is not longer than on_delay or off_delay, the fan will only ever be fully on or off"))
+		}
+	default:
+		return nil, nil, utils.NewFieldError(path, "control_mode", "unknown control mode %s", conf.ControlMode)
+	}
+
+	if (conf.OnTemperature != nil || conf.OffTemperature != nil || conf.OnValue != nil || conf.OffValue != nil) && conf.strategyName() != engine.StrategyHysteresis {
+		warnings = append(warnings, utils.NewConfigWarning(path, "on_temperature", "on_temperature and off_temperature, or on_value and off_value, are only used by the hysteresis strategy"))
+	}
+
+	if _, err := engine.ParseDirection(path, conf.Direction); err != nil {
+		return nil, nil, err
+	}
+
+	inputDeps, err := engine.ValidateInputs(path, conf.Inputs, conf.Quantity)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	if conf.SensorName == "" {
-		return nil, errors.New("sensor_name is required")
+	humidityDeps, err := engine.ValidateHumidity(path, conf.Humidity, conf.Inputs, conf.Quantity)
+	if err != nil {
+		return nil, nil, err
 	}
+	inputDeps = append(inputDeps, humidityDeps...)
 
-	if conf.SensorValueKey == "" {
-		return nil, errors.New("sensor_value_key is required")
+	_, strategyWarnings, err := conf.newStrategy(path, nil)
+	if err != nil {
+		return nil, nil, err
 	}
+	warnings = append(warnings, strategyWarnings...)
 
-	if conf.OnTemperature == 0 {
-		return nil, errors.New("on_temperature is required")
+	if err := utils.ValidateDelay(path, "override_duration", conf.OverrideDuration); err != nil {
+		return nil, nil, err
 	}
 
-	if conf.OffTemperature == 0 {
-		return nil, errors.New("off_temperature is required")
+	return append([]string{conf.BoardName, conf.SensorName}, inputDeps...), warnings, nil
+}
+
+// common adds the quantity, inputs, humidity and override config to what the engine handles for every model
+func (conf *CloudConfig) common() engine.Common {
+	common := conf.LoopAttributes.Common()
+	common.Quantity = conf.Quantity
+	common.Unit = conf.Unit
+	common.OverrideDuration = conf.OverrideDuration
+	common.Inputs = conf.Inputs
+	common.Humidity = conf.Humidity
+	return common
+}
+
+// hasTable is whether a table is configured at the top level, under either name
+func (conf *CloudConfig) hasTable() bool {
+	return conf.TemperatureTable != nil || conf.ValueTable != nil
+}
+
+// strategyName is the configured strategy. Without one, on/off control switches at on_temperature and
+// off_temperature, and time proportional control runs the pid if there is one or the temperature table.
+func (conf *CloudConfig) strategyName() string {
+	switch {
+	case conf.Strategy != "":
+		return conf.Strategy
+	case conf.ControlMode != ControlModeTimeProportional:
+		return engine.StrategyHysteresis
+	case conf.PID != nil:
+		return engine.StrategyPID
+	default:
+		return engine.StrategyTable
 	}
+}
 
-	return nil, nil
+// newStrategy builds the configured strategy. The built in strategies' attributes can be set at the top level,
+// which is how they were configured before there was a choice of strategy, anything in strategy_config wins.
+func (conf *CloudConfig) newStrategy(path string, previous engine.Strategy) (engine.Strategy, []utils.ConfigWarning, error) {
+	attributes := map[string]interface{}{
+		"on_delay":  conf.OnDelay,
+		"off_delay": conf.OffDelay,
+	}
+	if conf.OnTemperature != nil {
+		attributes["on_temperature"] = *conf.OnTemperature
+	}
+	if conf.OffTemperature != nil {
+		attributes["off_temperature"] = *conf.OffTemperature
+	}
+	if conf.OnValue != nil {
+		attributes["on_value"] = *conf.OnValue
+	}
+	if conf.OffValue != nil {
+		attributes["off_value"] = *conf.OffValue
+	}
+	if conf.TemperatureTable != nil {
+		attributes["temperature_table"] = conf.TemperatureTable
+	}
+	if conf.ValueTable != nil {
+		attributes["value_table"] = conf.ValueTable
+	}
+	if conf.PID != nil {
+		attributes["pid"] = conf.PID
+	}
+	if conf.Direction != "" {
+		attributes["direction"] = conf.Direction
+	}
+	for key, value := range conf.StrategyConfig {
+		attributes[key] = value
+	}
+	return engine.NewStrategy(conf.strategyName(), engine.StrategyConfig{Path: path, Attributes: attributes, Previous: previous, Inputs: engine.InputNames(conf.Inputs, conf.Humidity), Quantity: conf.Quantity})
 }
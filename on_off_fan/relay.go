@@ -0,0 +1,106 @@
+package on_off_fan
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.viam.com/rdk/components/board"
+	"go.viam.com/rdk/logging"
+
+	"github.com/rinzlerlabs/viam-fan-controller/engine"
+	"github.com/rinzlerlabs/viam-fan-controller/utils"
+)
+
+// relay switches a fan on and off with a GPIO pin. Any level above 0 is on, unless there's a time proportioner
+// to turn the level into on and off time.
+type relay struct {
+	pin          board.GPIOPin
+	claim        utils.Output
+	proportioner *timeProportioner
+	logger       logging.Logger
+	// What the pin was last set to, and when that changed
+	isOn            bool
+	lastStateChange time.Time
+	// The last level asked for, reported as the duty under time proportional control
+	duty float64
+}
+
+func (r *relay) Apply(ctx context.Context, now time.Time, level float64) error {
+	isRunning, err := r.pin.Get(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error getting fan state: %w", err)
+	}
+	r.isOn = isRunning
+
+	shouldBeOn := level > 0
+	if r.proportioner != nil {
+		r.duty = level
+		shouldBeOn = r.proportioner.shouldBeOn(now, level, isRunning, r.lastStateChange)
+	}
+	if shouldBeOn == isRunning {
+		return nil
+	}
+
+	onOff := "off"
+	if shouldBeOn {
+		onOff = "on"
+	}
+	if r.proportioner != nil {
+		r.logger.Infof("Turning fan %s, duty %f", onOff, level)
+	} else {
+		r.logger.Infof("Turning fan %s", onOff)
+	}
+	return r.set(ctx, now, shouldBeOn)
+}
+
+func (r *relay) Force(ctx context.Context, level float64) error {
+	return r.set(ctx, time.Now(), level > 0)
+}
+
+// set writes the pin without reading it first, so the failsafe still works when reads don't
+func (r *relay) set(ctx context.Context, now time.Time, on bool) error {
+	if err := r.pin.Set(ctx, on, nil); err != nil {
+		return fmt.Errorf("error setting fan state: %w", err)
+	}
+	if on != r.isOn {
+		r.lastStateChange = now
+	}
+	r.isOn = on
+	return nil
+}
+
+func (r *relay) State(ctx context.Context) (engine.State, error) {
+	isRunning, err := r.pin.Get(ctx, nil)
+	if err != nil {
+		return engine.State{}, err
+	}
+	state := engine.State{LastChange: r.lastStateChange}
+	if isRunning {
+		state.Level = 1
+	}
+	return state, nil
+}
+
+func (r *relay) Outputs() []utils.Output {
+	return []utils.Output{r.claim}
+}
+
+func (r *relay) Stop(ctx context.Context, outputs []utils.Output) error {
+	if !utils.IsReleased(outputs, r.claim) {
+		return nil
+	}
+	return r.pin.Set(ctx, false, nil)
+}
+
+func (r *relay) Readings(ctx context.Context) (map[string]interface{}, error) {
+	isRunning, err := r.pin.Get(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	result := map[string]interface{}{"fan_is_running": isRunning}
+	if r.proportioner != nil {
+		result["duty_pct"] = r.duty * 100
+	}
+	return result, nil
+}
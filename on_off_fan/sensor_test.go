@@ -1,44 +1,136 @@
 package on_off_fan
 
 import (
+	"context"
+	"errors"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"go.viam.com/rdk/components/board"
+	"go.viam.com/rdk/components/sensor"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/resource"
+
+	"github.com/rinzlerlabs/viam-fan-controller/engine"
+	"github.com/rinzlerlabs/viam-fan-controller/utils"
 )
 
-func TestShouldTurnFanOn(t *testing.T) {
-	// Temperature is below threshold, fan is off, and last state change was more than 1 second ago, fan should stay off
-	lastStateChange := time.Now().Add(-2 * time.Second)
-	assert.False(t, shouldTurnFanOn(25, 30, false, time.Duration(1*time.Second), lastStateChange))
+type fakePin struct {
+	board.GPIOPin
+	mu   sync.Mutex
+	high bool
+	// When set, reads panic, like a buggy board driver
+	broken bool
+}
+
+func (p *fakePin) Set(ctx context.Context, high bool, extra map[string]interface{}) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.high = high
+	return nil
+}
+
+func (p *fakePin) Get(ctx context.Context, extra map[string]interface{}) (bool, error) {
+	if p.broken {
+		panic("pin exploded")
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.high, nil
+}
+
+type fakeBoard struct {
+	board.Board
+	pins map[string]*fakePin
+}
+
+func (b *fakeBoard) GPIOPinByName(name string) (board.GPIOPin, error) {
+	pin, ok := b.pins[name]
+	if !ok {
+		return nil, errors.New("no such pin")
+	}
+	return pin, nil
+}
+
+type fakeSensor struct {
+	sensor.Sensor
+	temp float64
+}
+
+func (s *fakeSensor) Readings(ctx context.Context, extra map[string]interface{}) (map[string]interface{}, error) {
+	return map[string]interface{}{"temp": s.temp}, nil
+}
+
+func testDeps(fanBoard *fakeBoard) resource.Dependencies {
+	return resource.Dependencies{
+		board.Named("pi"):      fanBoard,
+		sensor.Named("sensor"): &fakeSensor{temp: 20},
+	}
+}
+
+func testResourceConfig(conf *CloudConfig) resource.Config {
+	return resource.Config{Name: "fan", API: sensor.API, Model: Model, ConvertedAttributes: conf}
+}
+
+func testCloudConfig(fanPin string) *CloudConfig {
+	on, off := 30.0, 25.0
+	return &CloudConfig{BoardName: "pi", FanPin: fanPin, LoopAttributes: engine.LoopAttributes{SensorName: "sensor", SensorValueKey: "temp"}, OnTemperature: &on, OffTemperature: &off}
+}
+
+func TestRelay(t *testing.T) {
+	ctx := context.Background()
+	pin := &fakePin{}
+	r := &relay{pin: pin, logger: logging.NewTestLogger(t)}
+	now := time.Now()
 
-	// Temperature is above threshold, fan is off, and last state change was more than 1 second ago, fan should turn on
-	lastStateChange = time.Now().Add(-2 * time.Second)
-	assert.True(t, shouldTurnFanOn(30, 30, false, time.Duration(1*time.Second), lastStateChange))
+	// Any level is on, and the switch is remembered for the delays
+	assert.NoError(t, r.Apply(ctx, now, 0.3))
+	assert.True(t, pin.high)
+	state, err := r.State(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, engine.State{Level: 1, LastChange: now}, state)
 
-	// Temperature is above threshold, fan is on, and last state change was more than 1 second ago, fan should stay on
-	lastStateChange = time.Now().Add(-2 * time.Second)
-	assert.False(t, shouldTurnFanOn(30, 30, true, time.Duration(1*time.Second), lastStateChange))
+	assert.NoError(t, r.Apply(ctx, now.Add(time.Second), 0))
+	assert.False(t, pin.high)
+	assert.Equal(t, now.Add(time.Second), r.lastStateChange)
 
-	// Temperature is above threshold, fan is off, and last state change was less than 1 second ago, fan should stay off
-	lastStateChange = time.Now().Add(-500 * time.Millisecond)
-	assert.False(t, shouldTurnFanOn(30, 30, false, time.Duration(1*time.Second), lastStateChange))
+	// Forcing the fan doesn't need the pin to be readable, so the failsafe still works
+	pin.broken = true
+	assert.NoError(t, r.Force(ctx, 1))
+	assert.True(t, pin.high)
 }
 
-func TestShouldTurnFanOff(t *testing.T) {
-	// Temperature is above threshold, fan is on, and last state change was more than 1 second ago, fan should stay on
-	lastStateChange := time.Now().Add(-2 * time.Second)
-	assert.False(t, shouldTurnFanOff(30, 30, true, time.Duration(1*time.Second), lastStateChange))
+func TestBuildCarriesRelayState(t *testing.T) {
+	ctx := context.Background()
+	fanBoard := &fakeBoard{pins: map[string]*fakePin{"11": {}, "13": {}}}
+	conf := testCloudConfig("11")
+	conf.OnTemperature, conf.OffTemperature = nil, nil
+	conf.ControlMode = ControlModeTimeProportional
+	conf.MaxCyclesPerHour = 4
+	conf.PID = &engine.PIDConfig{Setpoint: 40, Kp: 0.1}
+	logger := logging.NewTestLogger(t)
 
-	// Temperature is below threshold, fan is on, and last state change was more than 1 second ago, fan should turn off
-	lastStateChange = time.Now().Add(-2 * time.Second)
-	assert.True(t, shouldTurnFanOff(25, 30, true, time.Duration(1*time.Second), lastStateChange))
+	first, err := build(ctx, testDeps(fanBoard), testResourceConfig(conf), nil, logger)
+	assert.NoError(t, err)
+	assert.IsType(t, &engine.PID{}, first.Strategy)
+	firstRelay := first.Actuator.(*relay)
+	firstRelay.lastStateChange = time.Now()
+	firstRelay.proportioner.cycles = []time.Time{time.Now()}
 
-	// Temperature is below threshold, fan is off, and last state change was more than 1 second ago, fan should stay off
-	lastStateChange = time.Now().Add(-2 * time.Second)
-	assert.False(t, shouldTurnFanOff(25, 30, false, time.Duration(1*time.Second), lastStateChange))
+	// Moving pins shouldn't reset the cycle count, or it could be used to get around the limit
+	conf.FanPin = "13"
+	second, err := build(ctx, testDeps(fanBoard), testResourceConfig(conf), first, logger)
+	assert.NoError(t, err)
+	secondRelay := second.Actuator.(*relay)
+	assert.Equal(t, fanBoard.pins["13"], secondRelay.pin)
+	assert.Equal(t, firstRelay.proportioner.cycles, secondRelay.proportioner.cycles)
+	assert.Equal(t, firstRelay.lastStateChange, secondRelay.lastStateChange)
+	assert.Equal(t, []utils.Output{utils.GPIOOutput("pi", "13")}, second.Actuator.Outputs())
 
-	// Temperature is below threshold, fan is on, and last state change was less than 1 second ago, fan should stay on
-	lastStateChange = time.Now().Add(-500 * time.Millisecond)
-	assert.False(t, shouldTurnFanOff(25, 30, true, time.Duration(1*time.Second), lastStateChange))
+	// Plain on/off control runs the hysteresis
+	third, err := build(ctx, testDeps(fanBoard), testResourceConfig(testCloudConfig("11")), second, logger)
+	assert.NoError(t, err)
+	assert.Equal(t, &engine.Hysteresis{OnTemperature: 30, OffTemperature: 25, Direction: engine.DirectionCooling}, third.Strategy)
 }
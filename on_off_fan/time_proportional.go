@@ -0,0 +1,104 @@
+package on_off_fan
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	ControlModeOnOff            = "on_off"
+	ControlModeTimeProportional = "time_proportional"
+
+	defaultCycleWindow = 60 * time.Second
+)
+
+// timeProportioner turns a 0-1 duty into on/off time within a fixed window, i.e. very slow PWM for relays.
+// OnDelay and OffDelay become the minimum off and on times, and the number of times the relay is closed per hour is capped.
+type timeProportioner struct {
+	Window           time.Duration
+	MinOnTime        time.Duration
+	MinOffTime       time.Duration
+	MaxCyclesPerHour int
+	windowStart      time.Time
+	onTime           time.Duration
+	cycles           []time.Time
+}
+
+// window is the configured window, stretched if needed so one cycle per window can't exceed the cycles per hour limit
+func (t *timeProportioner) window() time.Duration {
+	if t.MaxCyclesPerHour > 0 {
+		minWindow := time.Hour / time.Duration(t.MaxCyclesPerHour)
+		if minWindow > t.Window {
+			return minWindow
+		}
+	}
+	return t.Window
+}
+
+// onTimeForDuty works out how long the fan should run in a window, respecting the minimum on and off times
+func (t *timeProportioner) onTimeForDuty(duty float64) time.Duration {
+	window := t.window()
+	duty = math.Max(0, math.Min(1, duty))
+	onTime := time.Duration(duty * float64(window))
+
+	// Too short to be worth closing the relay, round to whichever of off or the minimum on time is closer
+	if onTime > 0 && onTime < t.MinOnTime {
+		if onTime < t.MinOnTime/2 {
+			onTime = 0
+		} else {
+			onTime = t.MinOnTime
+		}
+	}
+
+	// Same for the off time, too short an off time means just stay on
+	offTime := window - onTime
+	if offTime > 0 && offTime < t.MinOffTime {
+		if offTime < t.MinOffTime/2 {
+			onTime = window
+		} else {
+			onTime = window - t.MinOffTime
+		}
+	}
+	return onTime
+}
+
+// shouldBeOn decides whether the relay should be closed right now for the given duty
+func (t *timeProportioner) shouldBeOn(now time.Time, duty float64, isRunning bool, lastStateChange time.Time) bool {
+	// The duty is only sampled at the start of each window, changing it mid window would chop the cycle up
+	if t.windowStart.IsZero() || !now.Before(t.windowStart.Add(t.window())) {
+		t.windowStart = now
+		t.onTime = t.onTimeForDuty(duty)
+	}
+
+	wantOn := now.Before(t.windowStart.Add(t.onTime))
+	if wantOn == isRunning {
+		return isRunning
+	}
+
+	// Minimum on and off times still apply across window boundaries
+	if wantOn && now.Before(lastStateChange.Add(t.MinOffTime)) {
+		return false
+	}
+	if !wantOn && now.Before(lastStateChange.Add(t.MinOnTime)) {
+		return true
+	}
+
+	if wantOn && t.MaxCyclesPerHour > 0 {
+		t.pruneCycles(now)
+		if len(t.cycles) >= t.MaxCyclesPerHour {
+			return false
+		}
+		t.cycles = append(t.cycles, now)
+	}
+	return wantOn
+}
+
+// pruneCycles forgets any relay closures more than an hour old
+func (t *timeProportioner) pruneCycles(now time.Time) {
+	cutoff := now.Add(-time.Hour)
+	i := 0
+	for i < len(t.cycles) && !t.cycles[i].After(cutoff) {
+		i++
+	}
+	t.cycles = t.cycles[i:]
+}
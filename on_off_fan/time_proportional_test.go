@@ -0,0 +1,73 @@
+package on_off_fan
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOnTimeForDuty(t *testing.T) {
+	tp := &timeProportioner{
+		Window:     60 * time.Second,
+		MinOnTime:  10 * time.Second,
+		MinOffTime: 10 * time.Second,
+	}
+
+	assert.Equal(t, 0*time.Second, tp.onTimeForDuty(0))
+	assert.Equal(t, 24*time.Second, tp.onTimeForDuty(0.4))
+	assert.Equal(t, 60*time.Second, tp.onTimeForDuty(1))
+
+	// Too short to run, rounds to off or up to the minimum on time
+	assert.Equal(t, 0*time.Second, tp.onTimeForDuty(0.05))
+	assert.Equal(t, 10*time.Second, tp.onTimeForDuty(0.1))
+
+	// Too short an off time, rounds to fully on or down to the minimum off time
+	assert.Equal(t, 60*time.Second, tp.onTimeForDuty(0.95))
+	assert.Equal(t, 50*time.Second, tp.onTimeForDuty(0.9))
+}
+
+func TestMaxCyclesStretchesWindow(t *testing.T) {
+	tp := &timeProportioner{Window: 60 * time.Second, MaxCyclesPerHour: 30}
+	assert.Equal(t, 2*time.Minute, tp.window())
+
+	tp.MaxCyclesPerHour = 120
+	assert.Equal(t, 60*time.Second, tp.window())
+}
+
+func TestShouldBeOnCyclesThroughWindow(t *testing.T) {
+	tp := &timeProportioner{Window: 60 * time.Second}
+	start := time.Now()
+
+	// 40% duty is on for the first 24 seconds of each window
+	isRunning := tp.shouldBeOn(start, 0.4, false, time.Time{})
+	assert.True(t, isRunning)
+	assert.True(t, tp.shouldBeOn(start.Add(20*time.Second), 0.4, isRunning, start))
+	isRunning = tp.shouldBeOn(start.Add(25*time.Second), 0.4, isRunning, start)
+	assert.False(t, isRunning)
+
+	// The duty changing mid window doesn't take effect until the next window
+	assert.False(t, tp.shouldBeOn(start.Add(30*time.Second), 1, isRunning, start.Add(25*time.Second)))
+	assert.True(t, tp.shouldBeOn(start.Add(60*time.Second), 1, isRunning, start.Add(25*time.Second)))
+}
+
+func TestShouldBeOnHonorsMinimumTimes(t *testing.T) {
+	tp := &timeProportioner{Window: 60 * time.Second, MinOffTime: 30 * time.Second}
+	start := time.Now()
+
+	// Fan was turned off 5 seconds ago, so even at full duty it has to wait
+	assert.False(t, tp.shouldBeOn(start, 1, false, start.Add(-5*time.Second)))
+	assert.True(t, tp.shouldBeOn(start.Add(30*time.Second), 1, false, start.Add(-5*time.Second)))
+}
+
+func TestShouldBeOnLimitsCyclesPerHour(t *testing.T) {
+	tp := &timeProportioner{Window: 60 * time.Second, MaxCyclesPerHour: 2}
+	now := time.Now()
+	tp.cycles = []time.Time{now.Add(-50 * time.Minute), now.Add(-20 * time.Minute)}
+
+	// Already closed the relay twice this hour
+	assert.False(t, tp.shouldBeOn(now, 1, false, time.Time{}))
+
+	// Once the oldest closure is more than an hour old, we can go again
+	assert.True(t, tp.shouldBeOn(now.Add(11*time.Minute), 1, false, time.Time{}))
+}
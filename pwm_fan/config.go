@@ -1,36 +1,323 @@
 package pwm_fan
 
-import "errors"
+import (
+	"fmt"
+
+	"go.viam.com/rdk/resource"
+
+	"github.com/rinzlerlabs/viam-fan-controller/engine"
+	"github.com/rinzlerlabs/viam-fan-controller/utils"
+)
 
 type CloudConfig struct {
-	BoardName        string             `json:"board_name"`
-	FanPin           string             `json:"fan_pin"`
-	SensorName       string             `json:"sensor_name"`
-	SensorValueKey   string             `json:"sensor_value_key"`
-	SensorValueRegex string             `json:"sensor_value_regex"`
-	TemperatureTable map[string]float64 `json:"temperature_table"`
+	engine.LoopAttributes `json:",squash"`
+	BoardName             string                 `json:"board_name"`
+	FanPin                string                 `json:"fan_pin"`
+	MotorName             string                 `json:"motor_name"`
+	Reverse               bool                   `json:"reverse"`
+	AnalogPin             string                 `json:"analog_pin"`
+	AnalogScale           *AnalogScale           `json:"analog_scale"`
+	Fans                  []FanConfig            `json:"fans"`
+	StaggerDelay          int64                  `json:"stagger_delay"`
+	Quantity              string                 `json:"quantity"`
+	Unit                  string                 `json:"unit"`
+	Strategy              string                 `json:"strategy"`
+	StrategyConfig        map[string]interface{} `json:"strategy_config"`
+	Inputs                []engine.InputConfig   `json:"inputs"`
+	Humidity              *engine.HumidityConfig `json:"humidity"`
+	TemperatureTable      map[string]float64     `json:"temperature_table"`
+	ValueTable            map[string]float64     `json:"value_table"`
+	Direction             string                 `json:"direction"`
+	OverrideDuration      int64                  `json:"override_duration"`
+}
+
+// FanConfig is a single fan in a zone, each fan gets the zone's duty adjusted by its own scale and offset
+type FanConfig struct {
+	FanPin      string       `json:"fan_pin"`
+	MotorName   string       `json:"motor_name"`
+	Reverse     bool         `json:"reverse"`
+	AnalogPin   string       `json:"analog_pin"`
+	AnalogScale *AnalogScale `json:"analog_scale"`
+	Scale       *float64     `json:"scale"`
+	Offset      float64      `json:"offset"`
+}
+
+// name is how the fan is identified in logs and readings
+func (f *FanConfig) name() string {
+	switch {
+	case f.MotorName != "":
+		return f.MotorName
+	case f.AnalogPin != "":
+		return f.AnalogPin
+	default:
+		return f.FanPin
+	}
+}
+
+// claim is the output this fan drives, for the module wide ownership registry
+func (f *FanConfig) claim(boardName string) utils.Output {
+	switch {
+	case f.MotorName != "":
+		return utils.MotorOutput(f.MotorName)
+	case f.AnalogPin != "":
+		return utils.AnalogOutput(boardName, f.AnalogPin)
+	default:
+		return utils.GPIOOutput(boardName, f.FanPin)
+	}
+}
+
+func (f *FanConfig) validate(path string, prefix string, boardName string) ([]utils.ConfigWarning, error) {
+	warnings := []utils.ConfigWarning{}
+	if f.MotorName != "" {
+		// A motor replaces the board/pin pair, it doesn't make sense to have both
+		if f.FanPin != "" || f.AnalogPin != "" {
+			return nil, utils.NewFieldError(path, prefix+"motor_name", "cannot be combined with fan_pin or analog_pin")
+		}
+	} else if f.AnalogPin != "" {
+		if boardName == "" {
+			return nil, resource.NewConfigValidationFieldRequiredError(path, "board_name")
+		}
+
+		if f.FanPin != "" {
+			return nil, utils.NewFieldError(path, prefix+"analog_pin", "cannot be combined with fan_pin")
+		}
+
+		if err := f.AnalogScale.validate(path, prefix+"analog_scale"); err != nil {
+			return nil, err
+		}
+	} else {
+		if boardName == "" {
+			return nil, resource.NewConfigValidationFieldRequiredError(path, "board_name")
+		}
+
+		if f.FanPin == "" {
+			return nil, resource.NewConfigValidationFieldRequiredError(path, prefix+"fan_pin")
+		}
+	}
+
+	if f.Reverse && f.MotorName == "" {
+		warnings = append(warnings, utils.NewConfigWarning(path, prefix+"reverse", "only applies to fans driven through motor_name"))
+	}
+
+	if f.AnalogScale != nil && f.AnalogPin == "" {
+		warnings = append(warnings, utils.NewConfigWarning(path, prefix+"analog_scale", "only applies to fans driven through analog_pin"))
+	}
+
+	if f.Scale != nil && *f.Scale < 0 {
+		return nil, utils.NewFieldError(path, prefix+"scale", "cannot be negative, got %v", *f.Scale)
+	}
+
+	if f.Scale != nil && *f.Scale == 0 && f.Offset <= 0 {
+		warnings = append(warnings, utils.NewConfigWarning(path, prefix+"scale", "is 0, this fan will never run"))
+	}
+
+	if f.Offset < -1 || f.Offset > 1 {
+		return nil, utils.NewFieldError(path, prefix+"offset", "must be between -1 and 1, got %v", f.Offset)
+	}
+
+	return warnings, nil
+}
+
+// AnalogScale describes how fan speeds map onto an analog output, e.g. a DAC driving a 0-10V EC fan
+type AnalogScale struct {
+	// The voltage to drive at the lowest non-zero fan speed, stopped fans always get 0V
+	MinVoltage float64 `json:"min_voltage"`
+	// The voltage to drive at full fan speed
+	MaxVoltage float64 `json:"max_voltage"`
+	// The voltage the DAC outputs when written its largest value
+	FullScaleVoltage float64 `json:"full_scale_voltage"`
+	// The largest value the DAC accepts, e.g. 4095 for a 12 bit DAC
+	MaxValue int `json:"max_value"`
+}
+
+func defaultAnalogScale() *AnalogScale {
+	return &AnalogScale{
+		MinVoltage:       0,
+		MaxVoltage:       10,
+		FullScaleVoltage: 10,
+		MaxValue:         4095,
+	}
+}
+
+// withDefaults fills in anything that wasn't configured from the 0-10V, 12 bit defaults
+func (s *AnalogScale) withDefaults() *AnalogScale {
+	scale := defaultAnalogScale()
+	if s == nil {
+		return scale
+	}
+	scale.MinVoltage = s.MinVoltage
+	if s.MaxVoltage != 0 {
+		scale.MaxVoltage = s.MaxVoltage
+	}
+	if s.FullScaleVoltage != 0 {
+		scale.FullScaleVoltage = s.FullScaleVoltage
+	}
+	if s.MaxValue != 0 {
+		scale.MaxValue = s.MaxValue
+	}
+	return scale
+}
+
+func (s *AnalogScale) validate(path string, field string) error {
+	scale := s.withDefaults()
+	if scale.MinVoltage < 0 {
+		return utils.NewFieldError(path, field+".min_voltage", "cannot be negative, got %v", scale.MinVoltage)
+	}
+	if scale.MaxVoltage <= scale.MinVoltage {
+		return utils.NewFieldError(path, field+".max_voltage", "must be greater than min_voltage %v, got %v", scale.MinVoltage, scale.MaxVoltage)
+	}
+	if scale.FullScaleVoltage <= 0 {
+		return utils.NewFieldError(path, field+".full_scale_voltage", "must be positive, got %v", scale.FullScaleVoltage)
+	}
+	if scale.MaxVoltage > scale.FullScaleVoltage {
+		return utils.NewFieldError(path, field+".max_voltage", "cannot be greater than full_scale_voltage %v, got %v", scale.FullScaleVoltage, scale.MaxVoltage)
+	}
+	if scale.MaxValue <= 0 {
+		return utils.NewFieldError(path, field+".max_value", "must be positive, got %v", scale.MaxValue)
+	}
+	return nil
+}
+
+// fans is every fan in the zone, a single fan configured at the top level is a zone of one
+func (conf *CloudConfig) fans() []FanConfig {
+	if len(conf.Fans) > 0 {
+		return conf.Fans
+	}
+	return []FanConfig{{
+		FanPin:      conf.FanPin,
+		MotorName:   conf.MotorName,
+		Reverse:     conf.Reverse,
+		AnalogPin:   conf.AnalogPin,
+		AnalogScale: conf.AnalogScale,
+	}}
 }
 
 func (conf *CloudConfig) Validate(path string) ([]string, error) {
-	if conf.BoardName == "" {
-		return nil, errors.New("board_name is required")
+	deps, _, err := conf.validate(path)
+	return deps, err
+}
+
+// validate does all the parsing and range checking, and also returns warnings for anything legal but suspicious
+func (conf *CloudConfig) validate(path string) ([]string, []utils.ConfigWarning, error) {
+	warnings := []utils.ConfigWarning{}
+	if len(conf.Fans) > 0 {
+		if conf.FanPin != "" || conf.MotorName != "" || conf.AnalogPin != "" {
+			return nil, nil, utils.NewFieldError(path, "fans", "cannot be combined with fan_pin, motor_name or analog_pin")
+		}
+		seen := make(map[utils.Output]bool)
+		for i, fan := range conf.Fans {
+			field := fmt.Sprintf("fans[%d]", i)
+			fanWarnings, err := fan.validate(path, field+".", conf.BoardName)
+			if err != nil {
+				return nil, nil, err
+			}
+			warnings = append(warnings, fanWarnings...)
+			if seen[fan.claim(conf.BoardName)] {
+				return nil, nil, utils.NewFieldError(path, field, "%s is used by more than one fan", fan.claim(conf.BoardName))
+			}
+			seen[fan.claim(conf.BoardName)] = true
+		}
+	} else {
+		fan := conf.fans()[0]
+		fanWarnings, err := fan.validate(path, "", conf.BoardName)
+		if err != nil {
+			return nil, nil, err
+		}
+		warnings = append(warnings, fanWarnings...)
+	}
+
+	if err := utils.ValidateDelay(path, "stagger_delay", conf.StaggerDelay); err != nil {
+		return nil, nil, err
+	}
+
+	if conf.StaggerDelay > 0 && len(conf.Fans) < 2 {
+		warnings = append(warnings, utils.NewConfigWarning(path, "stagger_delay", "only applies to zones with more than one fan"))
+	}
+
+	if err := conf.LoopAttributes.Validate(path); err != nil {
+		return nil, nil, err
 	}
 
-	if conf.FanPin == "" {
-		return nil, errors.New("fan_pin is required")
+	if err := engine.ValidateQuantity(path, conf.Quantity); err != nil {
+		return nil, nil, err
 	}
 
-	if conf.SensorName == "" {
-		return nil, errors.New("sensor_name is required")
+	if _, err := engine.ParseDirection(path, conf.Direction); err != nil {
+		return nil, nil, err
 	}
 
-	if conf.SensorValueKey == "" {
-		return nil, errors.New("sensor_value_key is required")
+	inputDeps, err := engine.ValidateInputs(path, conf.Inputs, conf.Quantity)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	if conf.TemperatureTable == nil {
-		return nil, errors.New("temperature_table is required")
+	humidityDeps, err := engine.ValidateHumidity(path, conf.Humidity, conf.Inputs, conf.Quantity)
+	if err != nil {
+		return nil, nil, err
 	}
+	inputDeps = append(inputDeps, humidityDeps...)
 
-	return nil, nil
+	_, strategyWarnings, err := conf.newStrategy(path, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	warnings = append(warnings, strategyWarnings...)
+
+	if err := utils.ValidateDelay(path, "override_duration", conf.OverrideDuration); err != nil {
+		return nil, nil, err
+	}
+
+	// The board is only needed if at least one fan isn't driven through a motor
+	deps := append([]string{conf.SensorName}, inputDeps...)
+	needsBoard := false
+	for _, fan := range conf.fans() {
+		if fan.MotorName != "" {
+			deps = append(deps, fan.MotorName)
+		} else {
+			needsBoard = true
+		}
+	}
+	if needsBoard {
+		deps = append(deps, conf.BoardName)
+	}
+
+	return deps, warnings, nil
+}
+
+// common adds the quantity, inputs, humidity and override config to what the engine handles for every model
+func (conf *CloudConfig) common() engine.Common {
+	common := conf.LoopAttributes.Common()
+	common.Quantity = conf.Quantity
+	common.Unit = conf.Unit
+	common.OverrideDuration = conf.OverrideDuration
+	common.Inputs = conf.Inputs
+	common.Humidity = conf.Humidity
+	return common
+}
+
+// strategyName is the configured strategy, the temperature table unless something else is asked for
+func (conf *CloudConfig) strategyName() string {
+	if conf.Strategy == "" {
+		return engine.StrategyTable
+	}
+	return conf.Strategy
+}
+
+// newStrategy builds the configured strategy. temperature_table, or value_table, can be set at the top level, which
+// is how it was configured before there was a choice of strategy, anything in strategy_config wins.
+func (conf *CloudConfig) newStrategy(path string, previous engine.Strategy) (engine.Strategy, []utils.ConfigWarning, error) {
+	attributes := map[string]interface{}{}
+	if conf.TemperatureTable != nil {
+		attributes["temperature_table"] = conf.TemperatureTable
+	}
+	if conf.ValueTable != nil {
+		attributes["value_table"] = conf.ValueTable
+	}
+	if conf.Direction != "" {
+		attributes["direction"] = conf.Direction
+	}
+	for key, value := range conf.StrategyConfig {
+		attributes[key] = value
+	}
+	return engine.NewStrategy(conf.strategyName(), engine.StrategyConfig{Path: path, Attributes: attributes, Previous: previous, Inputs: engine.InputNames(conf.Inputs, conf.Humidity), Quantity: conf.Quantity})
 }
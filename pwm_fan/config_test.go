@@ -0,0 +1,57 @@
+package pwm_fan
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/rinzlerlabs/viam-fan-controller/engine"
+)
+
+func TestValidateDependencies(t *testing.T) {
+	table := map[string]float64{"0": 0, "50": 100}
+
+	// A single pin needs the board and the sensor
+	conf := &CloudConfig{BoardName: "pi", FanPin: "15", LoopAttributes: engine.LoopAttributes{SensorName: "temps", SensorValueKey: "temp"}, TemperatureTable: table}
+	deps, err := conf.Validate("")
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"pi", "temps"}, deps)
+
+	// A motor doesn't need the board at all
+	conf = &CloudConfig{MotorName: "fan_motor", LoopAttributes: engine.LoopAttributes{SensorName: "temps", SensorValueKey: "temp"}, TemperatureTable: table}
+	deps, err = conf.Validate("")
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"fan_motor", "temps"}, deps)
+
+	// A zone needs every motor, and the board once
+	conf = &CloudConfig{
+		BoardName: "pi",
+		Fans: []FanConfig{
+			{FanPin: "12"},
+			{AnalogPin: "dac"},
+			{MotorName: "motor1"},
+			{MotorName: "motor2"},
+		},
+		LoopAttributes:   engine.LoopAttributes{SensorName: "temps", SensorValueKey: "temp"},
+		TemperatureTable: table,
+	}
+	deps, err = conf.Validate("")
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"pi", "motor1", "motor2", "temps"}, deps)
+}
+
+func TestDirection(t *testing.T) {
+	conf := &CloudConfig{BoardName: "pi", FanPin: "15", LoopAttributes: engine.LoopAttributes{SensorName: "temps", SensorValueKey: "temp"}, TemperatureTable: map[string]float64{"0": 100, "20": 0}}
+	strategy, _, err := conf.newStrategy("", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, engine.DirectionCooling, strategy.(*engine.Table).Direction)
+
+	conf.Direction = "heating"
+	strategy, _, err = conf.newStrategy("", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, engine.DirectionHeating, strategy.(*engine.Table).Direction)
+
+	conf.Direction = "up"
+	_, err = conf.Validate("")
+	assert.ErrorContains(t, err, "direction")
+}
@@ -0,0 +1,18 @@
+package pwm_fan
+
+import (
+	"context"
+
+	"go.viam.com/rdk/components/motor"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/resource"
+
+	"github.com/rinzlerlabs/viam-fan-controller/engine"
+)
+
+var MotorAPI = motor.API
+
+// NewMotor exposes the controller through the motor API, SetPower sets the whole zone's speed as a timed manual override
+func NewMotor(ctx context.Context, deps resource.Dependencies, conf resource.Config, logger logging.Logger) (motor.Motor, error) {
+	return engine.NewMotor(ctx, deps, conf, logger, controller)
+}
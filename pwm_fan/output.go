@@ -0,0 +1,99 @@
+package pwm_fan
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"go.viam.com/rdk/components/board"
+	"go.viam.com/rdk/components/motor"
+)
+
+// fanOutput is whatever is physically driving the fan, speeds are always 0-1
+type fanOutput interface {
+	SetSpeed(ctx context.Context, speed float64) error
+	Speed(ctx context.Context) (float64, error)
+}
+
+// The PWM frequency fan pins are driven at
+const pwmFrequency = 1000
+
+// pinOutput drives the fan directly from a PWM capable GPIO pin
+type pinOutput struct {
+	pin board.GPIOPin
+	// The frequency is set on the first write, building the output can't touch a pin another controller may still own
+	freqSet bool
+}
+
+func (o *pinOutput) SetSpeed(ctx context.Context, speed float64) error {
+	if !o.freqSet {
+		if err := o.pin.SetPWMFreq(ctx, pwmFrequency, nil); err != nil {
+			return fmt.Errorf("error setting PWM frequency: %w", err)
+		}
+		o.freqSet = true
+	}
+	return o.pin.SetPWM(ctx, speed, nil)
+}
+
+func (o *pinOutput) Speed(ctx context.Context) (float64, error) {
+	return o.pin.PWM(ctx, nil)
+}
+
+// motorOutput drives the fan through a motor component, reverse is for fans mounted to pull rather than push
+type motorOutput struct {
+	motor   motor.Motor
+	reverse bool
+}
+
+func (o *motorOutput) SetSpeed(ctx context.Context, speed float64) error {
+	return o.motor.SetPower(ctx, motorPower(speed, o.reverse), nil)
+}
+
+func (o *motorOutput) Speed(ctx context.Context) (float64, error) {
+	isPowered, powerPct, err := o.motor.IsPowered(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	if !isPowered {
+		return 0, nil
+	}
+	// Some motors report negative power when running backwards, the fan speed is the magnitude either way
+	return math.Abs(powerPct), nil
+}
+
+func motorPower(speed float64, reverse bool) float64 {
+	if reverse {
+		return -speed
+	}
+	return speed
+}
+
+// analogOutput drives the fan with a voltage from a board analog writer, typically a DAC feeding an EC fan
+type analogOutput struct {
+	analog board.Analog
+	scale  *AnalogScale
+	// DACs can't always be read back, so remember what was last written
+	speed float64
+}
+
+func (o *analogOutput) SetSpeed(ctx context.Context, speed float64) error {
+	if err := o.analog.Write(ctx, analogValue(speed, o.scale), nil); err != nil {
+		return err
+	}
+	o.speed = speed
+	return nil
+}
+
+func (o *analogOutput) Speed(ctx context.Context) (float64, error) {
+	return o.speed, nil
+}
+
+// analogValue converts a 0-1 fan speed into the raw value to write to the DAC
+func analogValue(speed float64, scale *AnalogScale) int {
+	if speed <= 0 {
+		return 0
+	}
+	speed = math.Min(speed, 1)
+	voltage := scale.MinVoltage + speed*(scale.MaxVoltage-scale.MinVoltage)
+	return int(math.Round(voltage / scale.FullScaleVoltage * float64(scale.MaxValue)))
+}
@@ -0,0 +1,113 @@
+package pwm_fan
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.viam.com/rdk/components/board"
+	"go.viam.com/rdk/components/motor"
+)
+
+// fakePin only implements the parts of the GPIO pin API the fan output uses
+type fakePin struct {
+	board.GPIOPin
+	freq uint
+	duty float64
+}
+
+func (p *fakePin) SetPWMFreq(ctx context.Context, freqHz uint, extra map[string]interface{}) error {
+	p.freq = freqHz
+	return nil
+}
+
+func (p *fakePin) SetPWM(ctx context.Context, dutyCyclePct float64, extra map[string]interface{}) error {
+	p.duty = dutyCyclePct
+	return nil
+}
+
+// fakeMotor only implements the parts of the motor API the fan output uses
+type fakeMotor struct {
+	motor.Motor
+	power float64
+}
+
+func (m *fakeMotor) SetPower(ctx context.Context, powerPct float64, extra map[string]interface{}) error {
+	m.power = powerPct
+	return nil
+}
+
+func (m *fakeMotor) IsPowered(ctx context.Context, extra map[string]interface{}) (bool, float64, error) {
+	return m.power != 0, m.power, nil
+}
+
+func TestPinOutputSetsFrequencyOnFirstWrite(t *testing.T) {
+	ctx := context.Background()
+	pin := &fakePin{}
+	output := &pinOutput{pin: pin}
+
+	// Nothing is written to the pin until the fan is driven
+	assert.Equal(t, uint(0), pin.freq)
+
+	assert.NoError(t, output.SetSpeed(ctx, 0.5))
+	assert.Equal(t, uint(pwmFrequency), pin.freq)
+	assert.Equal(t, 0.5, pin.duty)
+
+	// Only the first write sets the frequency
+	pin.freq = 0
+	assert.NoError(t, output.SetSpeed(ctx, 0.25))
+	assert.Equal(t, uint(0), pin.freq)
+	assert.Equal(t, 0.25, pin.duty)
+}
+
+func TestMotorOutput(t *testing.T) {
+	ctx := context.Background()
+	m := &fakeMotor{}
+
+	// Pushing fans get positive power
+	output := &motorOutput{motor: m}
+	assert.NoError(t, output.SetSpeed(ctx, 0.5))
+	assert.Equal(t, 0.5, m.power)
+	speed, err := output.Speed(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 0.5, speed)
+
+	// Pulling fans get negative power, but still report a positive speed
+	output = &motorOutput{motor: m, reverse: true}
+	assert.NoError(t, output.SetSpeed(ctx, 0.75))
+	assert.Equal(t, -0.75, m.power)
+	speed, err = output.Speed(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 0.75, speed)
+
+	// A stopped motor is a stopped fan
+	assert.NoError(t, output.SetSpeed(ctx, 0))
+	speed, err = output.Speed(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 0.0, speed)
+}
+
+func TestAnalogValue(t *testing.T) {
+	// 0-10V EC fan on a 12 bit DAC with a 10V full scale
+	scale := defaultAnalogScale()
+	assert.Equal(t, 0, analogValue(0, scale))
+	assert.Equal(t, 2048, analogValue(0.5, scale))
+	assert.Equal(t, 4095, analogValue(1, scale))
+	assert.Equal(t, 4095, analogValue(1.5, scale))
+
+	// Fan that needs 1V to start, DAC that goes to 5V and is amplified later
+	scale = (&AnalogScale{MinVoltage: 1, MaxVoltage: 5, FullScaleVoltage: 5, MaxValue: 255}).withDefaults()
+	assert.Equal(t, 0, analogValue(0, scale))
+	assert.Equal(t, 53, analogValue(0.01, scale))
+	assert.Equal(t, 153, analogValue(0.5, scale))
+	assert.Equal(t, 255, analogValue(1, scale))
+}
+
+func TestAnalogScaleValidate(t *testing.T) {
+	assert.NoError(t, (*AnalogScale)(nil).validate("", "analog_scale"))
+	assert.NoError(t, (&AnalogScale{MinVoltage: 2}).validate("", "analog_scale"))
+	assert.Error(t, (&AnalogScale{MinVoltage: -1}).validate("", "analog_scale"))
+	assert.Error(t, (&AnalogScale{MinVoltage: 8, MaxVoltage: 5}).validate("", "analog_scale"))
+	assert.Error(t, (&AnalogScale{MaxVoltage: 12}).validate("", "analog_scale"))
+	assert.Error(t, (&AnalogScale{MaxValue: -1}).validate("", "analog_scale"))
+}
@@ -2,19 +2,16 @@ package pwm_fan
 
 import (
 	"context"
-	"errors"
-	"regexp"
-	"sort"
-	"strconv"
-	"sync"
+	"fmt"
 	"time"
 
 	"go.viam.com/rdk/components/board"
+	"go.viam.com/rdk/components/motor"
 	"go.viam.com/rdk/components/sensor"
 	"go.viam.com/rdk/logging"
 	"go.viam.com/rdk/resource"
-	viam_utils "go.viam.com/utils"
 
+	"github.com/rinzlerlabs/viam-fan-controller/engine"
 	"github.com/rinzlerlabs/viam-fan-controller/utils"
 )
 
@@ -26,209 +23,108 @@ var (
 	Version     = utils.Version
 )
 
-type Config struct {
-	resource.Named
-	mu               sync.RWMutex
-	logger           logging.Logger
-	cancelCtx        context.Context
-	cancelFunc       func()
-	monitor          func()
-	done             chan bool
-	wg               sync.WaitGroup
-	FanPin           board.GPIOPin
-	Board            *board.Board
-	TemperatureTable map[float64]float64
-	Temps            []float64
-	Sensor           sensor.Sensor
-	SensorValueField string
-	SensorValueRegex *regexp.Regexp
-}
+var controller = engine.Model{PrettyName: PrettyName, Build: build}
 
 func init() {
 	resource.RegisterComponent(
 		sensor.API,
 		Model,
 		resource.Registration[sensor.Sensor, *CloudConfig]{Constructor: NewSensor})
+	resource.RegisterComponent(
+		motor.API,
+		Model,
+		resource.Registration[motor.Motor, *CloudConfig]{Constructor: NewMotor})
 }
 
 func NewSensor(ctx context.Context, deps resource.Dependencies, conf resource.Config, logger logging.Logger) (sensor.Sensor, error) {
-	logger.Infof("Starting %s %s", PrettyName, Version)
-	cancelCtx, cancelFunc := context.WithCancel(context.Background())
-
-	b := Config{
-		Named:      conf.ResourceName().AsNamed(),
-		logger:     logger,
-		cancelCtx:  cancelCtx,
-		cancelFunc: cancelFunc,
-		mu:         sync.RWMutex{},
-		done:       make(chan bool),
-	}
-
-	if err := b.Reconfigure(ctx, deps, conf); err != nil {
-		return nil, err
-	}
-	return &b, nil
+	return engine.New(ctx, deps, conf, logger, controller)
 }
 
-func (c *Config) Reconfigure(ctx context.Context, deps resource.Dependencies, conf resource.Config) error {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	c.logger.Debugf("Reconfiguring %s", PrettyName)
-
-	// In case the module has changed name
-	c.Named = conf.ResourceName().AsNamed()
-
+// build runs the configured strategy, the temperature table by default, against a zone of one or more fans
+func build(ctx context.Context, deps resource.Dependencies, conf resource.Config, previous *engine.Settings, logger logging.Logger) (*engine.Settings, error) {
 	newConf, err := resource.NativeConfig[*CloudConfig](conf)
 	if err != nil {
-		return err
-	}
-
-	untypedBoard, err := deps.Lookup(resource.NewName(board.API, newConf.BoardName))
-	if err != nil {
-		c.logger.Errorf("Error looking up board: %s", err)
-		return err
+		return nil, err
 	}
 
-	board := untypedBoard.(board.Board)
-	fanPin, err := board.GPIOPinByName(newConf.FanPin)
-	if err != nil {
-		c.logger.Errorf("Error looking up fan pin: %s", err)
-		return err
+	if err := engine.LogConfigWarnings(conf.ResourceName().ShortName(), newConf.validate, logger); err != nil {
+		return nil, err
 	}
 
-	untypedSensor, err := deps.Lookup(resource.NewName(sensor.API, newConf.SensorName))
-	if err != nil {
-		c.logger.Errorf("Error looking up sensor: %s", err)
-		return err
-	}
-	sensor := untypedSensor.(sensor.Sensor)
-
-	c.Named = conf.ResourceName().AsNamed()
-	c.Board = &board
-	c.FanPin = fanPin
-	c.Sensor = sensor
-	c.SensorValueField = newConf.SensorValueKey
-	c.SensorValueRegex = regexp.MustCompile(newConf.SensorValueRegex)
-
-	tempTable := make(map[float64]float64)
-	temps := make([]float64, 0, len(newConf.TemperatureTable))
-	for ts, speed := range newConf.TemperatureTable {
-		temp, err := strconv.ParseFloat(ts, 64)
-		if err != nil {
-			c.logger.Errorf("Error parsing temperature: %s", err)
-			return err
+	// Only fans driven through a motor can do without the board
+	var fanBoard *board.Board
+	fans := newConf.fans()
+	for _, fan := range fans {
+		if fan.MotorName != "" {
+			continue
 		}
-		if speed > 1 {
-			speed = speed / float64(100)
+		b, err := board.FromDependencies(deps, newConf.BoardName)
+		if err != nil {
+			return nil, fmt.Errorf("error looking up board %s: %w", newConf.BoardName, err)
 		}
-		tempTable[temp] = speed
-		temps = append(temps, temp)
+		fanBoard = &b
+		break
 	}
-	sort.Sort(sort.Reverse(sort.Float64Slice(temps)))
 
-	c.Temps = temps
-	c.TemperatureTable = tempTable
-	if fanPin.SetPWMFreq(ctx, 1000, nil) != nil {
-		c.logger.Errorf("Error setting PWM frequency: %s", err)
-		return err
-	}
-
-	if c.monitor == nil {
-		c.monitor = func() {
-			ctx := context.Background()
-			c.wg.Add(1)
-			defer c.wg.Done()
-			for {
-				select {
-				case <-c.done:
-					return
-				default:
-					readings, err := c.Sensor.Readings(ctx, nil)
-					if err != nil {
-						c.logger.Errorf("Error getting readings from sensor: %s", err)
-						break
-					}
-
-					currentTemp, err := utils.ParseCurrentTemperatureFromReadings(ctx, readings, c.SensorValueField, c.SensorValueRegex, c.logger)
-					if err != nil {
-						c.logger.Errorf("Error parsing current temperature: %s", err)
-						break
-					}
-
-					desiredSpeed, err := getDesiredSpeed(currentTemp, c.Temps, c.TemperatureTable)
-					if err != nil {
-						c.logger.Errorf("Error getting desired speed: %s", err)
-						break
-					}
-
-					c.logger.Debugf("Current temperature: %f, desired speed: %f", currentTemp, desiredSpeed)
-					err = c.FanPin.SetPWM(ctx, desiredSpeed, nil)
-					if err != nil {
-						c.logger.Errorf("Error setting fan speed: %s", err)
-					}
-				}
-
-				select {
-				case <-time.After(100 * time.Millisecond):
-					continue
-				case <-c.done:
-					return
-				}
-			}
+	fanZone := &zone{staggerDelay: time.Duration(newConf.StaggerDelay * int64(time.Second))}
+	for _, fan := range fans {
+		output, err := newOutput(deps, fanBoard, fan)
+		if err != nil {
+			return nil, err
 		}
-
-		viam_utils.PanicCapturingGo(c.monitor)
+		scale := 1.0
+		if fan.Scale != nil {
+			scale = *fan.Scale
+		}
+		fanZone.fans = append(fanZone.fans, &zoneFan{name: fan.name(), claim: fan.claim(newConf.BoardName), output: output, scale: scale, offset: fan.Offset})
 	}
 
-	return nil
-}
-
-func (c *Config) Readings(ctx context.Context, extra map[string]interface{}) (map[string]interface{}, error) {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
-	readings, err := c.Sensor.Readings(ctx, nil)
+	settings, err := engine.NewSettings(deps, conf.ResourceName().ShortName(), newConf.common())
 	if err != nil {
-		c.logger.Errorf("Error getting readings from sensor: %s", err)
 		return nil, err
 	}
 
-	currentTemp, err := utils.ParseCurrentTemperatureFromReadings(ctx, readings, c.SensorValueField, c.SensorValueRegex, c.logger)
-	if err != nil {
-		c.logger.Errorf("Error parsing current temperature: %s", err)
-		return nil, err
+	var previousStrategy engine.Strategy
+	if previous != nil {
+		previousStrategy = previous.Strategy
+		// Fans that were already running shouldn't have to wait out the stagger again
+		if oldZone, ok := previous.Actuator.(*zone); ok {
+			fanZone.startedAt = oldZone.startedAt
+		}
 	}
 
-	fan_speed, err := c.FanPin.PWM(ctx, nil)
+	strategy, _, err := newConf.newStrategy(conf.ResourceName().ShortName(), previousStrategy)
 	if err != nil {
-		c.logger.Errorf("Error getting fan speed: %s", err)
 		return nil, err
 	}
 
-	return map[string]interface{}{
-		"temperature":   currentTemp,
-		"fan_speed_pct": fan_speed * 100,
-	}, nil
+	settings.StrategyName = newConf.strategyName()
+	settings.Strategy = strategy
+	settings.Actuator = fanZone
+	return settings, nil
 }
 
-func (c *Config) Close(ctx context.Context) error {
-	c.logger.Infof("Shutting down %s", PrettyName)
-	c.done <- true
-	c.logger.Infof("Notifying monitor to shut down")
-	c.wg.Wait()
-	c.logger.Info("Monitor shut down")
-	return nil
-}
-
-func (c *Config) Ready(ctx context.Context, extra map[string]interface{}) (bool, error) {
-	return false, nil
-}
+// newOutput builds whatever drives a single fan in the zone
+func newOutput(deps resource.Dependencies, fanBoard *board.Board, fan FanConfig) (fanOutput, error) {
+	if fan.MotorName != "" {
+		fanMotor, err := motor.FromDependencies(deps, fan.MotorName)
+		if err != nil {
+			return nil, fmt.Errorf("error looking up motor %s: %w", fan.MotorName, err)
+		}
+		return &motorOutput{motor: fanMotor, reverse: fan.Reverse}, nil
+	}
 
-func getDesiredSpeed(currentTemp float64, temps []float64, tempTable map[float64]float64) (float64, error) {
-	for _, targetTemp := range temps {
-		if currentTemp >= targetTemp {
-			return tempTable[targetTemp], nil
+	if fan.AnalogPin != "" {
+		analog, err := (*fanBoard).AnalogByName(fan.AnalogPin)
+		if err != nil {
+			return nil, fmt.Errorf("error looking up analog pin %s: %w", fan.AnalogPin, err)
 		}
+		return &analogOutput{analog: analog, scale: fan.AnalogScale.withDefaults()}, nil
 	}
 
-	return 0, errors.New("temperature not found in table")
+	fanPin, err := (*fanBoard).GPIOPinByName(fan.FanPin)
+	if err != nil {
+		return nil, fmt.Errorf("error looking up fan pin %s: %w", fan.FanPin, err)
+	}
+	return &pinOutput{pin: fanPin}, nil
 }
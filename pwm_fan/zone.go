@@ -0,0 +1,162 @@
+package pwm_fan
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/rinzlerlabs/viam-fan-controller/engine"
+	"github.com/rinzlerlabs/viam-fan-controller/utils"
+)
+
+// zoneFan is a single fan in a zone and how it adjusts the zone's duty
+type zoneFan struct {
+	name   string
+	claim  utils.Output
+	output fanOutput
+	scale  float64
+	offset float64
+}
+
+// speedFor applies the fan's scale and offset, a stopped zone always means a stopped fan
+func (f *zoneFan) speedFor(duty float64) float64 {
+	if duty <= 0 {
+		return 0
+	}
+	return math.Max(0, math.Min(1, duty*f.scale+f.offset))
+}
+
+// zone drives several fans from one computed duty. It is a fanOutput itself, so the
+// motor API can drive the whole zone the same way it drives a single fan.
+type zone struct {
+	fans         []*zoneFan
+	staggerDelay time.Duration
+	// When the zone last went from stopped to running, fans start one stagger delay apart from here
+	startedAt time.Time
+}
+
+// SetSpeed sets every fan at once, skipping the staggered start
+func (z *zone) SetSpeed(ctx context.Context, duty float64) error {
+	if duty > 0 {
+		z.startedAt = time.Now().Add(-z.staggerDelay * time.Duration(len(z.fans)))
+	} else {
+		z.startedAt = time.Time{}
+	}
+
+	var errs []error
+	for _, fan := range z.fans {
+		if err := fan.output.SetSpeed(ctx, fan.speedFor(duty)); err != nil {
+			errs = append(errs, fmt.Errorf("fan %s: %w", fan.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Speed is the fastest fan in the zone
+func (z *zone) Speed(ctx context.Context) (float64, error) {
+	fastest := 0.0
+	for _, fan := range z.fans {
+		speed, err := fan.output.Speed(ctx)
+		if err != nil {
+			return 0, fmt.Errorf("fan %s: %w", fan.name, err)
+		}
+		fastest = math.Max(fastest, speed)
+	}
+	return fastest, nil
+}
+
+// setSpeedStaggered sets every fan from the zone duty, holding back fans that haven't reached their start time yet
+func (z *zone) setSpeedStaggered(ctx context.Context, now time.Time, duty float64) error {
+	var errs []error
+	for i, fan := range z.fans {
+		speed := 0.0
+		if z.isStarted(i, now, duty) {
+			speed = fan.speedFor(duty)
+		}
+		if err := fan.output.SetSpeed(ctx, speed); err != nil {
+			errs = append(errs, fmt.Errorf("fan %s: %w", fan.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// isStarted tracks the zone starting and stopping, and whether fan i's turn to start has come
+func (z *zone) isStarted(i int, now time.Time, duty float64) bool {
+	if duty <= 0 {
+		z.startedAt = time.Time{}
+		return false
+	}
+	if z.startedAt.IsZero() {
+		z.startedAt = now
+	}
+	return !now.Before(z.startedAt.Add(z.staggerDelay * time.Duration(i)))
+}
+
+// speeds is the actual speed of each fan, for readings
+func (z *zone) speeds(ctx context.Context) (map[string]interface{}, error) {
+	speeds := make(map[string]interface{}, len(z.fans))
+	for _, fan := range z.fans {
+		speed, err := fan.output.Speed(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("fan %s: %w", fan.name, err)
+		}
+		speeds[fan.name] = speed * 100
+	}
+	return speeds, nil
+}
+
+// Apply staggers fans starting, so a zone doesn't pull its whole inrush current at once
+func (z *zone) Apply(ctx context.Context, now time.Time, level float64) error {
+	return z.setSpeedStaggered(ctx, now, level)
+}
+
+func (z *zone) Force(ctx context.Context, level float64) error {
+	return z.SetSpeed(ctx, level)
+}
+
+func (z *zone) State(ctx context.Context) (engine.State, error) {
+	speed, err := z.Speed(ctx)
+	if err != nil {
+		return engine.State{}, err
+	}
+	return engine.State{Level: speed}, nil
+}
+
+func (z *zone) Outputs() []utils.Output {
+	outputs := make([]utils.Output, 0, len(z.fans))
+	for _, fan := range z.fans {
+		outputs = append(outputs, fan.claim)
+	}
+	return outputs
+}
+
+func (z *zone) Stop(ctx context.Context, outputs []utils.Output) error {
+	var errs []error
+	for _, fan := range z.fans {
+		if !utils.IsReleased(outputs, fan.claim) {
+			continue
+		}
+		if err := fan.output.SetSpeed(ctx, 0); err != nil {
+			errs = append(errs, fmt.Errorf("fan %s: %w", fan.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (z *zone) Readings(ctx context.Context) (map[string]interface{}, error) {
+	speed, err := z.Speed(ctx)
+	if err != nil {
+		return nil, err
+	}
+	result := map[string]interface{}{"fan_speed_pct": speed * 100}
+	if len(z.fans) > 1 {
+		fanSpeeds, err := z.speeds(ctx)
+		if err != nil {
+			return nil, err
+		}
+		result["fan_speeds_pct"] = fanSpeeds
+	}
+	return result, nil
+}
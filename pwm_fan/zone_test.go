@@ -0,0 +1,79 @@
+package pwm_fan
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeOutput just remembers the last speed it was set to
+type fakeOutput struct {
+	speed float64
+}
+
+func (o *fakeOutput) SetSpeed(ctx context.Context, speed float64) error {
+	o.speed = speed
+	return nil
+}
+
+func (o *fakeOutput) Speed(ctx context.Context) (float64, error) {
+	return o.speed, nil
+}
+
+func TestZoneFanSpeedFor(t *testing.T) {
+	fan := &zoneFan{scale: 0.5, offset: 0.1}
+	assert.Equal(t, 0.0, fan.speedFor(0))
+	assert.InDelta(t, 0.35, fan.speedFor(0.5), 0.0001)
+	assert.InDelta(t, 0.6, fan.speedFor(1), 0.0001)
+
+	// Never outside 0-1, whatever the scale and offset
+	fan = &zoneFan{scale: 2, offset: -0.5}
+	assert.Equal(t, 0.0, fan.speedFor(0.1))
+	assert.Equal(t, 1.0, fan.speedFor(0.9))
+}
+
+func TestZoneStaggeredStart(t *testing.T) {
+	ctx := context.Background()
+	outputs := []*fakeOutput{{}, {}, {}}
+	z := &zone{staggerDelay: 2 * time.Second}
+	for i, output := range outputs {
+		z.fans = append(z.fans, &zoneFan{name: string(rune('a' + i)), output: output, scale: 1})
+	}
+	now := time.Now()
+
+	// Only the first fan starts straight away
+	assert.NoError(t, z.setSpeedStaggered(ctx, now, 0.5))
+	assert.Equal(t, []float64{0.5, 0, 0}, []float64{outputs[0].speed, outputs[1].speed, outputs[2].speed})
+
+	assert.NoError(t, z.setSpeedStaggered(ctx, now.Add(2*time.Second), 0.5))
+	assert.Equal(t, []float64{0.5, 0.5, 0}, []float64{outputs[0].speed, outputs[1].speed, outputs[2].speed})
+
+	assert.NoError(t, z.setSpeedStaggered(ctx, now.Add(4*time.Second), 0.7))
+	assert.Equal(t, []float64{0.7, 0.7, 0.7}, []float64{outputs[0].speed, outputs[1].speed, outputs[2].speed})
+
+	// Stopping the zone resets the stagger for the next start
+	assert.NoError(t, z.setSpeedStaggered(ctx, now.Add(5*time.Second), 0))
+	assert.NoError(t, z.setSpeedStaggered(ctx, now.Add(6*time.Second), 0.5))
+	assert.Equal(t, []float64{0.5, 0, 0}, []float64{outputs[0].speed, outputs[1].speed, outputs[2].speed})
+
+	speed, err := z.Speed(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 0.5, speed)
+}
+
+func TestZoneSetSpeedSkipsStagger(t *testing.T) {
+	ctx := context.Background()
+	outputs := []*fakeOutput{{}, {}}
+	z := &zone{staggerDelay: time.Minute}
+	for _, output := range outputs {
+		z.fans = append(z.fans, &zoneFan{output: output, scale: 1})
+	}
+
+	// A manual override sets everything at once, and automatic control picks up without restaggering
+	assert.NoError(t, z.SetSpeed(ctx, 0.8))
+	assert.Equal(t, []float64{0.8, 0.8}, []float64{outputs[0].speed, outputs[1].speed})
+	assert.NoError(t, z.setSpeedStaggered(ctx, time.Now(), 0.6))
+	assert.Equal(t, []float64{0.6, 0.6}, []float64{outputs[0].speed, outputs[1].speed})
+}
@@ -0,0 +1,189 @@
+package staged_fan
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"go.viam.com/rdk/components/board"
+	"go.viam.com/rdk/logging"
+
+	"github.com/rinzlerlabs/viam-fan-controller/engine"
+	"github.com/rinzlerlabs/viam-fan-controller/utils"
+)
+
+// Levels come from dividing by the number of stages, this keeps 2/3 of 3 stages from rounding up to the third
+const levelTolerance = 1e-9
+
+// Stage is a single fan in the bank and its state
+type Stage struct {
+	FanPin          board.GPIOPin
+	FanPinName      string
+	claim           utils.Output
+	OnDelay         time.Duration
+	OffDelay        time.Duration
+	LastStateChange time.Time
+}
+
+// bank runs a number of its stages, in order, the level is the number running over the number of stages
+type bank struct {
+	stages         []*Stage
+	staggerDelay   time.Duration
+	lastStageStart time.Time
+	logger         logging.Logger
+}
+
+// stagesFor is how many stages to run at level, any level at all runs at least the first stage
+func (b *bank) stagesFor(level float64) int {
+	running := int(math.Ceil(level*float64(len(b.stages)) - levelTolerance))
+	return max(0, min(running, len(b.stages)))
+}
+
+// Apply works towards running the stages for level, at most one more each tick and no sooner than the stagger delay
+// after the last one, so the bank never starts all at once
+func (b *bank) Apply(ctx context.Context, now time.Time, level float64) error {
+	running, err := b.running(ctx)
+	if err != nil {
+		return fmt.Errorf("error getting fan states: %w", err)
+	}
+
+	turnOn, turnOff := stagesToChange(now, b.stagesFor(level), running, b.stages, b.lastStageStart, b.staggerDelay)
+	var errs []error
+	for _, i := range turnOff {
+		b.logger.Infof("Turning fan stage %d (pin %s) off", i+1, b.stages[i].FanPinName)
+		if err := b.stages[i].FanPin.Set(ctx, false, nil); err != nil {
+			errs = append(errs, fmt.Errorf("error turning fan stage %d off: %w", i+1, err))
+			continue
+		}
+		b.stages[i].LastStateChange = now
+	}
+	if turnOn >= 0 {
+		b.logger.Infof("Turning fan stage %d (pin %s) on", turnOn+1, b.stages[turnOn].FanPinName)
+		if err := b.stages[turnOn].FanPin.Set(ctx, true, nil); err != nil {
+			return errors.Join(append(errs, fmt.Errorf("error turning fan stage %d on: %w", turnOn+1, err))...)
+		}
+		b.stages[turnOn].LastStateChange = now
+		b.lastStageStart = now
+	}
+	return errors.Join(errs...)
+}
+
+// Force sets every stage at once, any level at all runs at least the first stage and the rest come on in proportion
+func (b *bank) Force(ctx context.Context, level float64) error {
+	running := b.stagesFor(level)
+	var errs []error
+	for i, stage := range b.stages {
+		if err := stage.FanPin.Set(ctx, i < running, nil); err != nil {
+			errs = append(errs, fmt.Errorf("fan pin %s: %w", stage.FanPinName, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (b *bank) State(ctx context.Context) (engine.State, error) {
+	running, err := b.running(ctx)
+	if err != nil {
+		return engine.State{}, err
+	}
+	count := 0
+	for _, isRunning := range running {
+		if isRunning {
+			count++
+		}
+	}
+	return engine.State{Level: float64(count) / float64(len(b.stages))}, nil
+}
+
+func (b *bank) Outputs() []utils.Output {
+	outputs := make([]utils.Output, 0, len(b.stages))
+	for _, stage := range b.stages {
+		outputs = append(outputs, stage.claim)
+	}
+	return outputs
+}
+
+func (b *bank) Stop(ctx context.Context, outputs []utils.Output) error {
+	var errs []error
+	for _, stage := range b.stages {
+		if !utils.IsReleased(outputs, stage.claim) {
+			continue
+		}
+		if err := stage.FanPin.Set(ctx, false, nil); err != nil {
+			errs = append(errs, fmt.Errorf("error turning off %s: %w", stage.claim, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (b *bank) Readings(ctx context.Context) (map[string]interface{}, error) {
+	running, err := b.running(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	runningCount := 0
+	energizedPins := make([]interface{}, 0, len(b.stages))
+	for i, isRunning := range running {
+		if isRunning {
+			runningCount++
+			energizedPins = append(energizedPins, b.stages[i].FanPinName)
+		}
+	}
+	return map[string]interface{}{
+		"running_stages": runningCount,
+		"stage_count":    len(b.stages),
+		"energized_pins": energizedPins,
+	}, nil
+}
+
+func (b *bank) running(ctx context.Context) ([]bool, error) {
+	running := make([]bool, len(b.stages))
+	for i, stage := range b.stages {
+		isRunning, err := stage.FanPin.Get(ctx, nil)
+		if err != nil {
+			return nil, err
+		}
+		running[i] = isRunning
+	}
+	return running, nil
+}
+
+// stagesToChange works out which stages to switch this tick to get to want running. Stages come on in order, at most
+// one per tick and no sooner than the stagger delay after the last one. They go off in reverse order, so a later stage
+// is never left running without the earlier ones. -1 means no stage turns on.
+func stagesToChange(now time.Time, want int, running []bool, stages []*Stage, lastStageStart time.Time, staggerDelay time.Duration) (int, []int) {
+	turnOff := []int{}
+	for i := len(stages) - 1; i >= want; i-- {
+		if !running[i] {
+			continue
+		}
+		// A stage that has to stay on a bit longer holds every stage below it on too
+		if !canSwitch(now, stages[i].OffDelay, stages[i].LastStateChange) {
+			break
+		}
+		turnOff = append(turnOff, i)
+		running[i] = false
+	}
+
+	if now.Before(lastStageStart.Add(staggerDelay)) {
+		return -1, turnOff
+	}
+	for i := 0; i < want; i++ {
+		if running[i] {
+			continue
+		}
+		if canSwitch(now, stages[i].OnDelay, stages[i].LastStateChange) {
+			return i, turnOff
+		}
+		// The next stage can't come on until this one is running
+		break
+	}
+	return -1, turnOff
+}
+
+// canSwitch is whether the last state change was long enough ago to change again
+func canSwitch(now time.Time, delay time.Duration, lastStateChange time.Time) bool {
+	return lastStateChange.Add(delay).Before(now)
+}
@@ -0,0 +1,82 @@
+package staged_fan
+
+import (
+	"fmt"
+
+	"go.viam.com/rdk/resource"
+
+	"github.com/rinzlerlabs/viam-fan-controller/engine"
+	"github.com/rinzlerlabs/viam-fan-controller/utils"
+)
+
+type CloudConfig struct {
+	engine.LoopAttributes `json:",squash"`
+	BoardName             string        `json:"board_name"`
+	Stages                []StageConfig `json:"stages"`
+	StaggerDelay          *int64        `json:"stagger_delay"`
+}
+
+// StageConfig is a single relay switched fan in the bank, stages are brought on in order
+type StageConfig struct {
+	FanPin         string  `json:"fan_pin"`
+	OnTemperature  float64 `json:"on_temperature"`
+	OffTemperature float64 `json:"off_temperature"`
+	OnDelay        int64   `json:"on_delay"`
+	OffDelay       int64   `json:"off_delay"`
+}
+
+func (conf *CloudConfig) Validate(path string) ([]string, error) {
+	deps, _, err := conf.validate(path)
+	return deps, err
+}
+
+// validate does all the range checking, and also returns warnings for anything legal but suspicious
+func (conf *CloudConfig) validate(path string) ([]string, []utils.ConfigWarning, error) {
+	warnings := []utils.ConfigWarning{}
+	if conf.BoardName == "" {
+		return nil, nil, resource.NewConfigValidationFieldRequiredError(path, "board_name")
+	}
+
+	if err := conf.LoopAttributes.Validate(path); err != nil {
+		return nil, nil, err
+	}
+
+	if len(conf.Stages) == 0 {
+		return nil, nil, resource.NewConfigValidationFieldRequiredError(path, "stages")
+	}
+
+	seen := make(map[string]bool)
+	for i, stage := range conf.Stages {
+		field := fmt.Sprintf("stages[%d]", i)
+		if stage.FanPin == "" {
+			return nil, nil, resource.NewConfigValidationFieldRequiredError(path, field+".fan_pin")
+		}
+		if seen[stage.FanPin] {
+			return nil, nil, utils.NewFieldError(path, field+".fan_pin", "%s is used by more than one stage", stage.FanPin)
+		}
+		seen[stage.FanPin] = true
+
+		if stage.OffTemperature >= stage.OnTemperature {
+			return nil, nil, utils.NewFieldError(path, field+".off_temperature", "must be less than on_temperature %v, got %v", stage.OnTemperature, stage.OffTemperature)
+		}
+		if err := utils.ValidateDelay(path, field+".on_delay", stage.OnDelay); err != nil {
+			return nil, nil, err
+		}
+		if err := utils.ValidateDelay(path, field+".off_delay", stage.OffDelay); err != nil {
+			return nil, nil, err
+		}
+
+		// Stages only come on in order, so a stage set cooler than the one before it just waits for it
+		if i > 0 && stage.OnTemperature < conf.Stages[i-1].OnTemperature {
+			warnings = append(warnings, utils.NewConfigWarning(path, field+".on_temperature", "is below stages[%d].on_temperature, this stage can't start until that one has", i-1))
+		}
+	}
+
+	if conf.StaggerDelay != nil {
+		if err := utils.ValidateDelay(path, "stagger_delay", *conf.StaggerDelay); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return []string{conf.BoardName, conf.SensorName}, warnings, nil
+}
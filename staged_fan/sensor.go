@@ -0,0 +1,127 @@
+package staged_fan
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"go.viam.com/rdk/components/board"
+	"go.viam.com/rdk/components/sensor"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/resource"
+
+	"github.com/rinzlerlabs/viam-fan-controller/engine"
+	"github.com/rinzlerlabs/viam-fan-controller/utils"
+)
+
+var (
+	Model       = resource.NewModel("rinzlerlabs", "fan", "staged")
+	API         = sensor.API
+	PrettyName  = "Staged Fan Controller"
+	Description = "A multi-stage on/off fan bank controller for Viam"
+	Version     = utils.Version
+)
+
+// How long to wait after starting one stage before starting the next if not configured, this keeps inrush current down
+const defaultStaggerDelay = 5 * time.Second
+
+// What the stage hysteresis is called in readings
+const strategyName = "stages"
+
+var controller = engine.Model{PrettyName: PrettyName, Build: build}
+
+func init() {
+	resource.RegisterComponent(
+		sensor.API,
+		Model,
+		resource.Registration[sensor.Sensor, *CloudConfig]{Constructor: NewSensor})
+}
+
+func NewSensor(ctx context.Context, deps resource.Dependencies, conf resource.Config, logger logging.Logger) (sensor.Sensor, error) {
+	return engine.New(ctx, deps, conf, logger, controller)
+}
+
+// build brings a bank of on/off fans on one stage at a time
+func build(ctx context.Context, deps resource.Dependencies, conf resource.Config, previous *engine.Settings, logger logging.Logger) (*engine.Settings, error) {
+	newConf, err := resource.NativeConfig[*CloudConfig](conf)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := engine.LogConfigWarnings(conf.ResourceName().ShortName(), newConf.validate, logger); err != nil {
+		return nil, err
+	}
+
+	fanBoard, err := board.FromDependencies(deps, newConf.BoardName)
+	if err != nil {
+		return nil, fmt.Errorf("error looking up board %s: %w", newConf.BoardName, err)
+	}
+
+	fanBank := &bank{staggerDelay: defaultStaggerDelay, logger: logger}
+	if newConf.StaggerDelay != nil {
+		fanBank.staggerDelay = time.Duration(*newConf.StaggerDelay * int64(time.Second))
+	}
+	for _, stageConf := range newConf.Stages {
+		fanPin, err := fanBoard.GPIOPinByName(stageConf.FanPin)
+		if err != nil {
+			return nil, fmt.Errorf("error looking up fan pin %s: %w", stageConf.FanPin, err)
+		}
+		fanBank.stages = append(fanBank.stages, &Stage{
+			FanPin:     fanPin,
+			FanPinName: stageConf.FanPin,
+			claim:      utils.GPIOOutput(newConf.BoardName, stageConf.FanPin),
+			OnDelay:    time.Duration(stageConf.OnDelay * int64(time.Second)),
+			OffDelay:   time.Duration(stageConf.OffDelay * int64(time.Second)),
+		})
+	}
+
+	// Fans that are staying keep their delays, so a reconfigure can't be used to cycle them early
+	if previous != nil {
+		if oldBank, ok := previous.Actuator.(*bank); ok {
+			fanBank.lastStageStart = oldBank.lastStageStart
+			for _, old := range oldBank.stages {
+				for _, stage := range fanBank.stages {
+					if stage.claim == old.claim {
+						stage.LastStateChange = old.LastStateChange
+					}
+				}
+			}
+		}
+	}
+
+	settings, err := engine.NewSettings(deps, conf.ResourceName().ShortName(), newConf.Common())
+	if err != nil {
+		return nil, err
+	}
+
+	settings.StrategyName = strategyName
+	settings.Strategy = &stageHysteresis{stages: newConf.Stages}
+	settings.Actuator = fanBank
+	return settings, nil
+}
+
+// stageHysteresis works out how many stages the temperature calls for, the bank brings them on and off in turn
+type stageHysteresis struct {
+	stages []StageConfig
+}
+
+func (s *stageHysteresis) Demand(in engine.Input) (engine.Output, error) {
+	count := float64(len(s.stages))
+	running := int(math.Round(in.State.Level * count))
+	desired := desiredStages(in.Primary().Value, running, s.stages)
+	return engine.Output{Level: float64(desired) / count}, nil
+}
+
+// desiredStages counts up through the stages whose on temperature has been reached, in order, since a stage can't
+// come on before the one ahead of it. It then counts back down from the top through the stages whose off
+// temperature the temperature has dropped below.
+func desiredStages(currentTemp float64, running int, stages []StageConfig) int {
+	for running < len(stages) && currentTemp >= stages[running].OnTemperature {
+		running++
+	}
+	for running > 0 && currentTemp < stages[running-1].OffTemperature {
+		running--
+	}
+	return running
+}
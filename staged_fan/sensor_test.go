@@ -0,0 +1,94 @@
+package staged_fan
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testStageConfigs() []StageConfig {
+	return []StageConfig{
+		{FanPin: "11", OnTemperature: 30, OffTemperature: 25},
+		{FanPin: "13", OnTemperature: 35, OffTemperature: 30},
+		{FanPin: "15", OnTemperature: 40, OffTemperature: 35},
+	}
+}
+
+func testStages() []*Stage {
+	return []*Stage{{FanPinName: "11"}, {FanPinName: "13"}, {FanPinName: "15"}}
+}
+
+func TestDesiredStagesOnlyAsManyAsNeeded(t *testing.T) {
+	stages := testStageConfigs()
+
+	assert.Equal(t, 0, desiredStages(28, 0, stages))
+	assert.Equal(t, 3, desiredStages(50, 0, stages))
+
+	// Warm enough for the second stage but not the third
+	assert.Equal(t, 2, desiredStages(37, 0, stages))
+	assert.Equal(t, 2, desiredStages(37, 2, stages))
+
+	// A stage that comes on cooler than the one ahead of it waits for it
+	stages[2].OnTemperature, stages[2].OffTemperature = 32, 28
+	assert.Equal(t, 1, desiredStages(33, 0, stages))
+	assert.Equal(t, 3, desiredStages(33, 2, stages))
+}
+
+func TestDesiredStagesShutsDownFromTheTop(t *testing.T) {
+	stages := testStageConfigs()
+
+	// Cold enough for everything to go off
+	assert.Equal(t, 0, desiredStages(20, 3, stages))
+
+	// Only the top stage has cooled off enough
+	assert.Equal(t, 2, desiredStages(33, 3, stages))
+}
+
+func TestStagesToChangeStaggersStartup(t *testing.T) {
+	now := time.Now()
+	stages := testStages()
+	stagger := 5 * time.Second
+
+	// Every stage is wanted, but only the first comes on
+	on, off := stagesToChange(now, 3, []bool{false, false, false}, stages, time.Time{}, stagger)
+	assert.Equal(t, 0, on)
+	assert.Empty(t, off)
+
+	// Nothing else comes on until the stagger delay has passed
+	on, _ = stagesToChange(now.Add(time.Second), 3, []bool{true, false, false}, stages, now, stagger)
+	assert.Equal(t, -1, on)
+	on, _ = stagesToChange(now.Add(6*time.Second), 3, []bool{true, false, false}, stages, now, stagger)
+	assert.Equal(t, 1, on)
+}
+
+func TestStagesToChangeShutsDownInReverse(t *testing.T) {
+	now := time.Now()
+	stages := testStages()
+
+	on, off := stagesToChange(now, 0, []bool{true, true, true}, stages, time.Time{}, 0)
+	assert.Equal(t, -1, on)
+	assert.Equal(t, []int{2, 1, 0}, off)
+
+	on, off = stagesToChange(now, 2, []bool{true, true, true}, stages, time.Time{}, 0)
+	assert.Equal(t, -1, on)
+	assert.Equal(t, []int{2}, off)
+}
+
+func TestStagesToChangeHonorsStageDelays(t *testing.T) {
+	now := time.Now()
+	stages := testStages()
+	stages[0].OffDelay = 10 * time.Second
+	stages[0].LastStateChange = now.Add(-5 * time.Second)
+
+	// First stage only just came on, it has to stay on a bit longer
+	_, off := stagesToChange(now, 0, []bool{true, false, false}, stages, time.Time{}, 0)
+	assert.Empty(t, off)
+	_, off = stagesToChange(now.Add(6*time.Second), 0, []bool{true, false, false}, stages, time.Time{}, 0)
+	assert.Equal(t, []int{0}, off)
+
+	// And it holds the stages above it on while it waits
+	stages[1].LastStateChange = now.Add(-time.Minute)
+	_, off = stagesToChange(now, 0, []bool{true, true, false}, stages, time.Time{}, 0)
+	assert.Equal(t, []int{1}, off)
+}
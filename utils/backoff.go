@@ -0,0 +1,83 @@
+package utils
+
+import (
+	"time"
+
+	"go.viam.com/rdk/logging"
+)
+
+// How often a run of identical errors gets a summary log line
+const errorSummaryInterval = time.Minute
+
+// Backoff stretches the wait between passes of a control loop while they keep failing
+type Backoff struct {
+	failures int
+}
+
+// Next is how long to wait before the next pass. Every failure in a row doubles the wait, up to max,
+// and the first pass that works goes straight back to interval.
+func (b *Backoff) Next(err error, interval time.Duration, max time.Duration) time.Duration {
+	if err == nil {
+		b.failures = 0
+		return interval
+	}
+
+	b.failures++
+	wait := interval
+	for i := 1; i < b.failures && wait < max; i++ {
+		wait *= 2
+	}
+	return min(wait, max)
+}
+
+// Failures is how many passes in a row have failed
+func (b *Backoff) Failures() int {
+	return b.failures
+}
+
+// ErrorLogger keeps a failing control loop from flooding the logs. The first time an error shows up it's logged,
+// repeats of the same error are only counted and summarized every so often, and recovering is logged once.
+type ErrorLogger struct {
+	Logger logging.Logger
+	last   string
+	// Repeats of last since it was last logged
+	repeats int
+	// Every error since the loop last worked
+	failures   int
+	lastLogged time.Time
+}
+
+// Log records the result of one pass of the loop
+func (l *ErrorLogger) Log(now time.Time, err error) {
+	if err == nil {
+		if l.failures > 0 {
+			l.Logger.Infof("Recovered after %d errors in a row", l.failures)
+		}
+		*l = ErrorLogger{Logger: l.Logger}
+		return
+	}
+
+	l.failures++
+	message := err.Error()
+	if message != l.last {
+		l.flush()
+		l.Logger.Errorf("Error in control loop: %s", message)
+		l.last = message
+		l.lastLogged = now
+		return
+	}
+
+	l.repeats++
+	if now.Sub(l.lastLogged) >= errorSummaryInterval {
+		l.flush()
+		l.lastLogged = now
+	}
+}
+
+// flush logs how many times the last error has repeated since it was last logged
+func (l *ErrorLogger) flush() {
+	if l.repeats > 0 {
+		l.Logger.Errorf("Error in control loop: %s (repeated %d more times)", l.last, l.repeats)
+	}
+	l.repeats = 0
+}
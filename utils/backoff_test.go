@@ -0,0 +1,57 @@
+package utils
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.viam.com/rdk/logging"
+)
+
+func TestBackoff(t *testing.T) {
+	b := &Backoff{}
+	failed := errors.New("sensor unavailable")
+
+	assert.Equal(t, 100*time.Millisecond, b.Next(nil, 100*time.Millisecond, time.Second))
+
+	// Each failure in a row doubles the wait, up to the cap
+	assert.Equal(t, 100*time.Millisecond, b.Next(failed, 100*time.Millisecond, time.Second))
+	assert.Equal(t, 200*time.Millisecond, b.Next(failed, 100*time.Millisecond, time.Second))
+	assert.Equal(t, 400*time.Millisecond, b.Next(failed, 100*time.Millisecond, time.Second))
+	assert.Equal(t, 800*time.Millisecond, b.Next(failed, 100*time.Millisecond, time.Second))
+	assert.Equal(t, time.Second, b.Next(failed, 100*time.Millisecond, time.Second))
+	assert.Equal(t, time.Second, b.Next(failed, 100*time.Millisecond, time.Second))
+	assert.Equal(t, 6, b.Failures())
+
+	// One good pass and we're back to normal
+	assert.Equal(t, 100*time.Millisecond, b.Next(nil, 100*time.Millisecond, time.Second))
+	assert.Equal(t, 0, b.Failures())
+}
+
+func TestErrorLogger(t *testing.T) {
+	logger, logs := logging.NewObservedTestLogger(t)
+	l := &ErrorLogger{Logger: logger}
+	now := time.Now()
+	failed := errors.New("sensor unavailable")
+
+	// The first error is logged, the repeats are only counted
+	for i := 0; i < 100; i++ {
+		l.Log(now.Add(time.Duration(i)*100*time.Millisecond), failed)
+	}
+	assert.Equal(t, 1, logs.FilterMessageSnippet("sensor unavailable").Len())
+
+	// After a while there's a summary of how many there were
+	l.Log(now.Add(time.Minute), failed)
+	assert.Equal(t, 1, logs.FilterMessageSnippet("repeated 100 more times").Len())
+
+	// A different error is logged straight away
+	l.Log(now.Add(time.Minute), errors.New("pin unavailable"))
+	assert.Equal(t, 1, logs.FilterMessageSnippet("pin unavailable").Len())
+
+	// And so is recovering
+	l.Log(now.Add(time.Minute), nil)
+	assert.Equal(t, 1, logs.FilterMessageSnippet("Recovered after 102 errors").Len())
+	l.Log(now.Add(time.Minute), nil)
+	assert.Equal(t, 1, logs.FilterMessageSnippet("Recovered").Len())
+}
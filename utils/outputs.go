@@ -0,0 +1,102 @@
+package utils
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Output is anything a controller drives, only one controller in the module may drive a given output
+type Output struct {
+	Kind  string
+	Board string
+	Name  string
+}
+
+func GPIOOutput(boardName string, pin string) Output {
+	return Output{Kind: "fan pin", Board: boardName, Name: pin}
+}
+
+func AnalogOutput(boardName string, pin string) Output {
+	return Output{Kind: "analog pin", Board: boardName, Name: pin}
+}
+
+func MotorOutput(motorName string) Output {
+	return Output{Kind: "motor", Name: motorName}
+}
+
+func (o Output) String() string {
+	if o.Board != "" {
+		return fmt.Sprintf("%s %s on board %s", o.Kind, o.Name, o.Board)
+	}
+	return fmt.Sprintf("%s %s", o.Kind, o.Name)
+}
+
+var (
+	outputsMu    sync.Mutex
+	outputOwners = make(map[Output]string)
+)
+
+// ClaimOutputs makes owner the only controller allowed to drive outputs. Anything owner previously claimed that
+// isn't in outputs is released and returned, so the caller can leave those outputs in a safe state. Either every
+// output is claimed or, if any is owned by someone else, nothing changes.
+func ClaimOutputs(owner string, outputs []Output) ([]Output, error) {
+	outputsMu.Lock()
+	defer outputsMu.Unlock()
+
+	claimed := make(map[Output]bool, len(outputs))
+	for _, output := range outputs {
+		if current, ok := outputOwners[output]; ok && current != owner {
+			return nil, fmt.Errorf("%s is already in use by %s", output, current)
+		}
+		claimed[output] = true
+	}
+
+	released := []Output{}
+	for output, current := range outputOwners {
+		if current == owner && !claimed[output] {
+			released = append(released, output)
+		}
+	}
+
+	releaseOutputsLocked(owner)
+	for _, output := range outputs {
+		outputOwners[output] = owner
+	}
+	return released, nil
+}
+
+// IsReleased is whether output is one of the outputs ClaimOutputs gave up
+func IsReleased(released []Output, output Output) bool {
+	for _, r := range released {
+		if r == output {
+			return true
+		}
+	}
+	return false
+}
+
+// RenameOwner moves everything claimed by from over to to, for a controller that has been renamed
+func RenameOwner(from string, to string) {
+	outputsMu.Lock()
+	defer outputsMu.Unlock()
+	for output, current := range outputOwners {
+		if current == from {
+			outputOwners[output] = to
+		}
+	}
+}
+
+// ReleaseOutputs gives up everything owner has claimed
+func ReleaseOutputs(owner string) {
+	outputsMu.Lock()
+	defer outputsMu.Unlock()
+	releaseOutputsLocked(owner)
+}
+
+func releaseOutputsLocked(owner string) {
+	for output, current := range outputOwners {
+		if current == owner {
+			delete(outputOwners, output)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClaimOutputs(t *testing.T) {
+	defer ReleaseOutputs("fan1")
+	defer ReleaseOutputs("fan2")
+
+	released, err := ClaimOutputs("fan1", []Output{GPIOOutput("pi", "11"), MotorOutput("exhaust")})
+	assert.NoError(t, err)
+	assert.Empty(t, released)
+
+	// Reclaiming your own outputs is fine
+	released, err = ClaimOutputs("fan1", []Output{GPIOOutput("pi", "11"), MotorOutput("exhaust")})
+	assert.NoError(t, err)
+	assert.Empty(t, released)
+
+	// Someone else can't have them, and the error says who owns it
+	_, err = ClaimOutputs("fan2", []Output{GPIOOutput("pi", "13"), GPIOOutput("pi", "11")})
+	assert.EqualError(t, err, "fan pin 11 on board pi is already in use by fan1")
+
+	// A failed claim doesn't leave anything behind
+	released, err = ClaimOutputs("fan1", []Output{GPIOOutput("pi", "13")})
+	assert.NoError(t, err)
+
+	// fan1 moved off pin 11 and the motor, so they're free now and fan1 is told so
+	assert.ElementsMatch(t, []Output{GPIOOutput("pi", "11"), MotorOutput("exhaust")}, released)
+	assert.True(t, IsReleased(released, MotorOutput("exhaust")))
+	assert.False(t, IsReleased(released, GPIOOutput("pi", "13")))
+	_, err = ClaimOutputs("fan2", []Output{GPIOOutput("pi", "11"), MotorOutput("exhaust")})
+	assert.NoError(t, err)
+
+	// The same pin name on a different board is a different pin
+	_, err = ClaimOutputs("fan2", []Output{GPIOOutput("pi", "11"), GPIOOutput("other", "13")})
+	assert.NoError(t, err)
+
+	ReleaseOutputs("fan1")
+	_, err = ClaimOutputs("fan2", []Output{GPIOOutput("pi", "13")})
+	assert.NoError(t, err)
+}
+
+func TestRenameOwner(t *testing.T) {
+	defer ReleaseOutputs("fan1")
+	defer ReleaseOutputs("fan2")
+
+	_, err := ClaimOutputs("fan1", []Output{GPIOOutput("pi", "11")})
+	assert.NoError(t, err)
+	RenameOwner("fan1", "fan2")
+
+	// The old name has nothing left to leak
+	_, err = ClaimOutputs("fan1", []Output{GPIOOutput("pi", "11")})
+	assert.EqualError(t, err, "fan pin 11 on board pi is already in use by fan2")
+	ReleaseOutputs("fan2")
+	_, err = ClaimOutputs("fan1", []Output{GPIOOutput("pi", "11")})
+	assert.NoError(t, err)
+}
@@ -0,0 +1,107 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	CloseFullSpeed = "full_speed"
+	CloseOff       = "off"
+	CloseLeave     = "leave"
+	CloseFixed     = "fixed"
+)
+
+// How long a controller gets to put its fans in their close state before giving up, if the caller doesn't set a shorter deadline
+const CloseTimeout = 5 * time.Second
+
+// ClosePolicy is what a controller does with its fans when it's closed, either because it was removed or the module is shutting down
+type ClosePolicy struct {
+	Mode string
+	// Only used by fixed, from 0-1
+	Duty float64
+}
+
+// ParseClosePolicy parses full_speed, off, leave or fixed:<duty> with the duty in percent. Nothing set means leave,
+// which is how controllers always behaved before the policy existed.
+func ParseClosePolicy(path string, field string, raw string) (ClosePolicy, error) {
+	switch raw {
+	case "", CloseLeave:
+		return ClosePolicy{Mode: CloseLeave}, nil
+	case CloseFullSpeed:
+		return ClosePolicy{Mode: CloseFullSpeed, Duty: 1}, nil
+	case CloseOff:
+		return ClosePolicy{Mode: CloseOff}, nil
+	}
+
+	dutyString, ok := strings.CutPrefix(raw, CloseFixed+":")
+	if !ok {
+		return ClosePolicy{}, NewFieldError(path, field, "must be one of %s, %s, %s or %s:<duty>, got %s", CloseFullSpeed, CloseOff, CloseLeave, CloseFixed, raw)
+	}
+	duty, err := strconv.ParseFloat(dutyString, 64)
+	if err != nil {
+		return ClosePolicy{}, NewFieldError(path, field, "%s is not a valid duty", dutyString)
+	}
+	if duty < 0 || duty > 100 {
+		return ClosePolicy{}, NewFieldError(path, field, "duty must be between 0 and 100, got %v", duty)
+	}
+	return ClosePolicy{Mode: CloseFixed, Duty: duty / 100}, nil
+}
+
+// Leaves is whether the policy leaves the fans alone
+func (p ClosePolicy) Leaves() bool {
+	return p.Mode == CloseLeave || p.Mode == ""
+}
+
+func (p ClosePolicy) String() string {
+	if p.Mode == CloseFixed {
+		return fmt.Sprintf("%s:%v", CloseFixed, p.Duty*100)
+	}
+	return p.Mode
+}
+
+// WaitContext waits for wg, but gives up when ctx is done
+func WaitContext(ctx context.Context, wg *sync.WaitGroup) error {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// RunWithTimeout runs fn, but stops waiting on it after timeout or when ctx is done, whichever comes first.
+// fn gets a context with the same deadline so well behaved calls give up too. A panic in fn is returned as an error.
+func RunWithTimeout(ctx context.Context, timeout time.Duration, fn func(ctx context.Context) error) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	result := make(chan error, 1)
+	go func() {
+		// This goroutine isn't covered by whatever recovers panics for the caller, so a misbehaving driver would take the module down
+		defer func() {
+			if r := recover(); r != nil {
+				result <- fmt.Errorf("panic: %v", r)
+			}
+		}()
+		result <- fn(ctx)
+	}()
+
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		return errors.Join(errors.New("timed out"), ctx.Err())
+	}
+}
@@ -0,0 +1,57 @@
+package utils
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseClosePolicy(t *testing.T) {
+	policy, err := ParseClosePolicy("fan", "on_close", "")
+	assert.NoError(t, err)
+	assert.True(t, policy.Leaves())
+
+	policy, err = ParseClosePolicy("fan", "on_close", "full_speed")
+	assert.NoError(t, err)
+	assert.False(t, policy.Leaves())
+	assert.Equal(t, 1.0, policy.Duty)
+
+	policy, err = ParseClosePolicy("fan", "on_close", "off")
+	assert.NoError(t, err)
+	assert.Equal(t, 0.0, policy.Duty)
+
+	policy, err = ParseClosePolicy("fan", "on_close", "fixed:40")
+	assert.NoError(t, err)
+	assert.Equal(t, 0.4, policy.Duty)
+	assert.Equal(t, "fixed:40", policy.String())
+
+	_, err = ParseClosePolicy("fan", "on_close", "fixed:140")
+	assert.ErrorContains(t, err, "on_close")
+
+	_, err = ParseClosePolicy("fan", "on_close", "fixed:fast")
+	assert.Error(t, err)
+
+	_, err = ParseClosePolicy("fan", "on_close", "spin")
+	assert.Error(t, err)
+}
+
+func TestRunWithTimeout(t *testing.T) {
+	assert.NoError(t, RunWithTimeout(context.Background(), time.Second, func(ctx context.Context) error { return nil }))
+
+	// Something that ignores its context doesn't hold us up
+	hang := make(chan struct{})
+	defer close(hang)
+	start := time.Now()
+	err := RunWithTimeout(context.Background(), 50*time.Millisecond, func(ctx context.Context) error {
+		<-hang
+		return nil
+	})
+	assert.Error(t, err)
+	assert.Less(t, time.Since(start), time.Second)
+
+	// A panic comes back as an error instead of taking everything down
+	err = RunWithTimeout(context.Background(), time.Second, func(ctx context.Context) error { panic("boom") })
+	assert.ErrorContains(t, err, "boom")
+}
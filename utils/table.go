@@ -0,0 +1,69 @@
+package utils
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// ParseTemperatureTable turns a config temperature table into duties from 0-1 keyed by temperature, plus the
+// temperatures sorted from hottest to coldest. If any duty is over 1 the whole table is treated as percentages,
+// otherwise it's treated as fractions, so the two are never mixed. Heating tables are expected to run faster as the
+// temperature drops, cooling tables as it rises.
+func ParseTemperatureTable(path string, field string, raw map[string]float64, heating bool) (map[float64]float64, []float64, []ConfigWarning, error) {
+	if len(raw) == 0 {
+		return nil, nil, nil, NewFieldError(path, field, "must have at least one entry")
+	}
+
+	isPercent := false
+	for _, duty := range raw {
+		if duty > 1 {
+			isPercent = true
+		}
+	}
+
+	warnings := []ConfigWarning{}
+	table := make(map[float64]float64, len(raw))
+	temps := make([]float64, 0, len(raw))
+	for ts, duty := range raw {
+		entry := fmt.Sprintf("%s[%q]", field, ts)
+		temp, err := strconv.ParseFloat(ts, 64)
+		if err != nil {
+			return nil, nil, nil, NewFieldError(path, entry, "%s is not a number", ts)
+		}
+		if duty < 0 || duty > 100 {
+			return nil, nil, nil, NewFieldError(path, entry, "duty must be between 0 and 100, got %v", duty)
+		}
+		if _, ok := table[temp]; ok {
+			return nil, nil, nil, NewFieldError(path, entry, "temperature %v is in the table more than once", temp)
+		}
+		if isPercent {
+			if duty > 0 && duty <= 1 {
+				warnings = append(warnings, NewConfigWarning(path, entry, "duty %v looks like a fraction but the table is in percent, this is %v%%", duty, duty))
+			}
+			duty = duty / 100
+		}
+		table[temp] = duty
+		temps = append(temps, temp)
+	}
+	sort.Sort(sort.Reverse(sort.Float64Slice(temps)))
+
+	maxDuty := 0.0
+	for _, duty := range table {
+		maxDuty = max(maxDuty, duty)
+	}
+	if maxDuty < 1 {
+		warnings = append(warnings, NewConfigWarning(path, field, "never reaches 100%%, the highest duty is %v%%", maxDuty*100))
+	}
+	for i := 1; i < len(temps); i++ {
+		colder, hotter := table[temps[i]], table[temps[i-1]]
+		if !heating && colder > hotter {
+			warnings = append(warnings, NewConfigWarning(path, field, "duty drops from %v%% to %v%% as the temperature rises from %v to %v", colder*100, hotter*100, temps[i], temps[i-1]))
+		}
+		if heating && colder < hotter {
+			warnings = append(warnings, NewConfigWarning(path, field, "duty rises from %v%% to %v%% as the temperature rises from %v to %v, but the direction is heating", colder*100, hotter*100, temps[i], temps[i-1]))
+		}
+	}
+
+	return table, temps, warnings, nil
+}
@@ -0,0 +1,61 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTemperatureTable(t *testing.T) {
+	// Percentages are scaled down and the temperatures come back hottest first
+	table, temps, warnings, err := ParseTemperatureTable("fan", "temperature_table", map[string]float64{"30": 25, "40": 50, "50": 100}, false)
+	assert.NoError(t, err)
+	assert.Empty(t, warnings)
+	assert.Equal(t, []float64{50, 40, 30}, temps)
+	assert.Equal(t, map[float64]float64{50: 1, 40: 0.5, 30: 0.25}, table)
+
+	// Fractions are left alone
+	table, _, warnings, err = ParseTemperatureTable("fan", "temperature_table", map[string]float64{"30": 0.5, "50": 1}, false)
+	assert.NoError(t, err)
+	assert.Empty(t, warnings)
+	assert.Equal(t, map[float64]float64{50: 1, 30: 0.5}, table)
+
+	// A fraction in a percent table is almost certainly a mistake
+	table, _, warnings, err = ParseTemperatureTable("fan", "temperature_table", map[string]float64{"30": 0.5, "50": 100}, false)
+	assert.NoError(t, err)
+	assert.Len(t, warnings, 1)
+	assert.Equal(t, 0.005, table[30])
+
+	// Never getting to full speed is legal, but worth mentioning
+	_, _, warnings, err = ParseTemperatureTable("fan", "temperature_table", map[string]float64{"30": 20, "50": 60}, false)
+	assert.NoError(t, err)
+	assert.Len(t, warnings, 1)
+	assert.Contains(t, warnings[0].String(), "never reaches 100%")
+
+	// So is slowing down as it gets hotter
+	_, _, warnings, err = ParseTemperatureTable("fan", "temperature_table", map[string]float64{"30": 100, "50": 60}, false)
+	assert.NoError(t, err)
+	assert.Len(t, warnings, 1)
+	assert.Contains(t, warnings[0].String(), "duty drops")
+
+	// Unless the fan is heating, then it's the other way around
+	_, _, warnings, err = ParseTemperatureTable("fan", "temperature_table", map[string]float64{"5": 100, "10": 60, "15": 30, "20": 0}, true)
+	assert.NoError(t, err)
+	assert.Empty(t, warnings)
+	_, _, warnings, err = ParseTemperatureTable("fan", "temperature_table", map[string]float64{"5": 0, "20": 100}, true)
+	assert.NoError(t, err)
+	assert.Len(t, warnings, 1)
+	assert.Contains(t, warnings[0].String(), "duty rises")
+
+	_, _, _, err = ParseTemperatureTable("fan", "temperature_table", map[string]float64{}, false)
+	assert.Error(t, err)
+
+	_, _, _, err = ParseTemperatureTable("fan", "temperature_table", map[string]float64{"hot": 100}, false)
+	assert.ErrorContains(t, err, `temperature_table["hot"]`)
+
+	_, _, _, err = ParseTemperatureTable("fan", "temperature_table", map[string]float64{"50": 150}, false)
+	assert.ErrorContains(t, err, "between 0 and 100")
+
+	_, _, _, err = ParseTemperatureTable("fan", "temperature_table", map[string]float64{"50": 100, "50.0": 50}, false)
+	assert.ErrorContains(t, err, "more than once")
+}
@@ -27,16 +27,16 @@ func ParseCurrentTemperatureFromReadings(ctx context.Context, readings map[strin
 		// First cast it to a string
 		rawCurrentTemp := readings[sensorValueField].(string)
 		if rawCurrentTemp == "" {
-			logger.Errorf("Error reading sensor, field %s not found", sensorValueField)
+			logger.Debugf("Error reading sensor, field %s not found", sensorValueField)
 			return 0, fmt.Errorf("error reading sensor, field %s not found", sensorValueField)
 		}
 		var currentTempString string
 		if sensorValueRegex != nil {
 			// Now try to use the regex to parse out the value
-			currentTempString := sensorValueRegex.FindString(rawCurrentTemp)
+			currentTempString = sensorValueRegex.FindString(rawCurrentTemp)
 			if currentTempString == "" {
-				logger.Errorf("Error reading sensor, no match to regex in %s", currentTempString)
-				return 0, fmt.Errorf("error reading sensor, no match to regex in %s", currentTempString)
+				logger.Debugf("Error reading sensor, no match to regex in %s", rawCurrentTemp)
+				return 0, fmt.Errorf("error reading sensor, no match to regex in %s", rawCurrentTemp)
 			}
 		} else {
 			// If we don't have a regex, just use the whole string
@@ -45,7 +45,7 @@ func ParseCurrentTemperatureFromReadings(ctx context.Context, readings map[strin
 		// Now convert it to a float and return it
 		return strconv.ParseFloat(currentTempString, 64)
 	default:
-		logger.Errorf("Error reading sensor, field %s is unknown type", sensorValueField)
+		logger.Debugf("Error reading sensor, field %s is unknown type", sensorValueField)
 		return 0, fmt.Errorf("error reading sensor, field %s is unknown type", sensorValueField)
 	}
 }
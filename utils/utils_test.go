@@ -0,0 +1,39 @@
+package utils
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.viam.com/rdk/logging"
+)
+
+func TestParseCurrentTemperatureFromReadings(t *testing.T) {
+	ctx := context.Background()
+	logger := logging.NewTestLogger(t)
+	readings := map[string]interface{}{"number": 42.5, "int": 42, "plain": "42.5", "labeled": "temp=42.5C"}
+
+	temp, err := ParseCurrentTemperatureFromReadings(ctx, readings, "number", nil, logger)
+	assert.NoError(t, err)
+	assert.Equal(t, 42.5, temp)
+
+	temp, err = ParseCurrentTemperatureFromReadings(ctx, readings, "int", nil, logger)
+	assert.NoError(t, err)
+	assert.Equal(t, 42.0, temp)
+
+	temp, err = ParseCurrentTemperatureFromReadings(ctx, readings, "plain", nil, logger)
+	assert.NoError(t, err)
+	assert.Equal(t, 42.5, temp)
+
+	// The regex match is what gets parsed, not the whole string
+	temp, err = ParseCurrentTemperatureFromReadings(ctx, readings, "labeled", regexp.MustCompile(`[0-9.]+`), logger)
+	assert.NoError(t, err)
+	assert.Equal(t, 42.5, temp)
+
+	_, err = ParseCurrentTemperatureFromReadings(ctx, readings, "labeled", regexp.MustCompile(`[0-9]+%`), logger)
+	assert.ErrorContains(t, err, "no match to regex in temp=42.5C")
+
+	_, err = ParseCurrentTemperatureFromReadings(ctx, readings, "missing", nil, logger)
+	assert.Error(t, err)
+}
@@ -0,0 +1,50 @@
+package utils
+
+import (
+	"fmt"
+	"regexp"
+
+	"go.viam.com/rdk/resource"
+)
+
+// NewFieldError is an invalid config value, field is the full path to the value e.g. stages[1].on_temperature
+func NewFieldError(path string, field string, format string, args ...interface{}) error {
+	return resource.NewConfigValidationError(path, fmt.Errorf("%s: %s", field, fmt.Sprintf(format, args...)))
+}
+
+// ConfigWarning is a config value that is legal, but probably not what was intended
+type ConfigWarning struct {
+	Path    string
+	Field   string
+	Message string
+}
+
+func NewConfigWarning(path string, field string, format string, args ...interface{}) ConfigWarning {
+	return ConfigWarning{Path: path, Field: field, Message: fmt.Sprintf(format, args...)}
+}
+
+func (w ConfigWarning) String() string {
+	if w.Path == "" {
+		return fmt.Sprintf("%s: %s", w.Field, w.Message)
+	}
+	return fmt.Sprintf("%s: %s (path %q)", w.Field, w.Message, w.Path)
+}
+
+// ValidateRegex makes sure an optional regex compiles, so Reconfigure never has to fail on it
+func ValidateRegex(path string, field string, expr string) error {
+	if expr == "" {
+		return nil
+	}
+	if _, err := regexp.Compile(expr); err != nil {
+		return NewFieldError(path, field, "invalid regex: %s", err)
+	}
+	return nil
+}
+
+// ValidateDelay makes sure a delay in seconds isn't negative
+func ValidateDelay(path string, field string, seconds int64) error {
+	if seconds < 0 {
+		return NewFieldError(path, field, "cannot be negative, got %d", seconds)
+	}
+	return nil
+}
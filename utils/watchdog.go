@@ -0,0 +1,212 @@
+package utils
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.viam.com/rdk/components/sensor"
+)
+
+const (
+	defaultPollInterval     = 100 * time.Millisecond
+	defaultMaxBackoff       = 10 * time.Second
+	defaultOperationTimeout = 5 * time.Second
+	defaultWatchdogTimeout  = 30 * time.Second
+)
+
+// LoopConfig is the control loop config shared by every model, as it comes from the model's config
+type LoopConfig struct {
+	// In seconds, fractions are fine
+	PollInterval float64
+	// In seconds
+	MaxBackoff       int64
+	OperationTimeout int64
+	WatchdogTimeout  int64
+	// In percent
+	FailsafeDuty *float64
+}
+
+// LoopSettings is how a controller's control loop is run and supervised
+type LoopSettings struct {
+	// How long to wait between passes of the loop when everything is working
+	PollInterval time.Duration
+	// The longest to wait between passes while they keep failing
+	MaxBackoff time.Duration
+	// The longest a single sensor read or pass of the control loop may take
+	OperationTimeout time.Duration
+	// How long the loop can go without finishing a pass before the watchdog restarts it
+	WatchdogTimeout time.Duration
+	// The duty, from 0-1, fans are set to while a stuck loop is restarted
+	FailsafeDuty float64
+}
+
+// ParseLoopSettings validates the loop config and fills in the defaults
+func ParseLoopSettings(path string, conf LoopConfig) (LoopSettings, error) {
+	settings := LoopSettings{
+		PollInterval:     defaultPollInterval,
+		MaxBackoff:       defaultMaxBackoff,
+		OperationTimeout: defaultOperationTimeout,
+		WatchdogTimeout:  defaultWatchdogTimeout,
+		FailsafeDuty:     1,
+	}
+
+	if conf.PollInterval < 0 {
+		return LoopSettings{}, NewFieldError(path, "poll_interval", "cannot be negative, got %v", conf.PollInterval)
+	}
+	if conf.PollInterval > 0 {
+		settings.PollInterval = time.Duration(conf.PollInterval * float64(time.Second))
+	}
+	if settings.PollInterval < 10*time.Millisecond {
+		return LoopSettings{}, NewFieldError(path, "poll_interval", "must be at least 0.01 seconds, got %v", conf.PollInterval)
+	}
+
+	if conf.MaxBackoff < 0 {
+		return LoopSettings{}, NewFieldError(path, "max_backoff", "cannot be negative, got %d", conf.MaxBackoff)
+	}
+	if conf.MaxBackoff > 0 {
+		settings.MaxBackoff = time.Duration(conf.MaxBackoff) * time.Second
+	}
+	// Backing off can only ever slow the loop down
+	settings.MaxBackoff = max(settings.MaxBackoff, settings.PollInterval)
+
+	if conf.OperationTimeout < 0 {
+		return LoopSettings{}, NewFieldError(path, "operation_timeout", "cannot be negative, got %d", conf.OperationTimeout)
+	}
+	if conf.OperationTimeout > 0 {
+		settings.OperationTimeout = time.Duration(conf.OperationTimeout) * time.Second
+	}
+
+	if conf.WatchdogTimeout < 0 {
+		return LoopSettings{}, NewFieldError(path, "watchdog_timeout", "cannot be negative, got %d", conf.WatchdogTimeout)
+	}
+	if conf.WatchdogTimeout > 0 {
+		settings.WatchdogTimeout = time.Duration(conf.WatchdogTimeout) * time.Second
+	}
+
+	// A loop that's just waiting on a slow sensor isn't stuck, so it has to be given longer than that
+	if settings.WatchdogTimeout <= settings.OperationTimeout {
+		return LoopSettings{}, NewFieldError(path, "watchdog_timeout", "must be longer than operation_timeout %s, got %s", settings.OperationTimeout, settings.WatchdogTimeout)
+	}
+
+	if conf.FailsafeDuty != nil {
+		if *conf.FailsafeDuty < 0 || *conf.FailsafeDuty > 100 {
+			return LoopSettings{}, NewFieldError(path, "failsafe_duty", "must be between 0 and 100, got %v", *conf.FailsafeDuty)
+		}
+		settings.FailsafeDuty = *conf.FailsafeDuty / 100
+	}
+	return settings, nil
+}
+
+// Watchdog notices when a control loop stops finishing passes, whether it's stuck or it died.
+// Each loop joins with its own generation, so a stuck loop that eventually wakes up knows it's been replaced.
+type Watchdog struct {
+	mu         sync.Mutex
+	timeout    time.Duration
+	generation int
+	lastBeat   time.Time
+	// Whether the current loop has finished a pass yet, a loop that's only just started isn't healthy until it has
+	beaten   bool
+	restarts int
+}
+
+// SetTimeout changes how long the loop can go without a beat
+func (w *Watchdog) SetTimeout(timeout time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.timeout = timeout
+}
+
+// Join registers a new loop, any loop that joined before it is told to exit on its next beat
+func (w *Watchdog) Join(now time.Time) int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.generation++
+	w.lastBeat = now
+	w.beaten = false
+	return w.generation
+}
+
+// Beat records that the loop finished a pass and is going to wait before the next one, the wait doesn't count
+// against the timeout. False means the loop has been replaced and should exit.
+func (w *Watchdog) Beat(generation int, now time.Time, wait time.Duration) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if generation != w.generation {
+		return false
+	}
+	w.lastBeat = now.Add(wait)
+	w.beaten = true
+	return true
+}
+
+// Restarted counts a restart, and gives the new loop a full timeout to get going
+func (w *Watchdog) Restarted(now time.Time) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.restarts++
+	w.lastBeat = now
+	w.beaten = false
+}
+
+// Health is whether the loop has beaten recently enough, and how many times it's been restarted
+func (w *Watchdog) Health(now time.Time) (bool, int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.beaten && !w.stalledLocked(now), w.restarts
+}
+
+func (w *Watchdog) stalledLocked(now time.Time) bool {
+	return w.generation > 0 && now.Sub(w.lastBeat) > w.timeout
+}
+
+// Watch calls onStall whenever the loop misses its timeout, until ctx is done
+func (w *Watchdog) Watch(ctx context.Context, onStall func()) {
+	for {
+		w.mu.Lock()
+		interval := max(w.timeout/4, 100*time.Millisecond)
+		w.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+
+		w.mu.Lock()
+		stalled := w.stalledLocked(time.Now())
+		w.mu.Unlock()
+		if stalled {
+			onStall()
+		}
+	}
+}
+
+// ReadSensor gets the sensor's readings, but gives up after timeout even if the sensor ignores its context
+func ReadSensor(ctx context.Context, s sensor.Sensor, timeout time.Duration) (map[string]interface{}, error) {
+	var readings map[string]interface{}
+	err := RunWithTimeout(ctx, timeout, func(ctx context.Context) error {
+		var err error
+		readings, err = s.Readings(ctx, nil)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return readings, nil
+}
+
+// LockWithTimeout tries to take mu for up to timeout. A control loop that's stuck part way through a pass holds
+// the lock forever, so anything that has to act on a stuck loop can't just wait for it.
+func LockWithTimeout(mu *sync.RWMutex, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for {
+		if mu.TryLock() {
+			return true
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,109 @@
+package utils
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLoopSettings(t *testing.T) {
+	settings, err := ParseLoopSettings("fan", LoopConfig{})
+	assert.NoError(t, err)
+	assert.Equal(t, defaultPollInterval, settings.PollInterval)
+	assert.Equal(t, defaultMaxBackoff, settings.MaxBackoff)
+	assert.Equal(t, defaultOperationTimeout, settings.OperationTimeout)
+	assert.Equal(t, defaultWatchdogTimeout, settings.WatchdogTimeout)
+	assert.Equal(t, 1.0, settings.FailsafeDuty)
+
+	failsafe := 60.0
+	settings, err = ParseLoopSettings("fan", LoopConfig{PollInterval: 0.5, MaxBackoff: 60, OperationTimeout: 2, WatchdogTimeout: 10, FailsafeDuty: &failsafe})
+	assert.NoError(t, err)
+	assert.Equal(t, 500*time.Millisecond, settings.PollInterval)
+	assert.Equal(t, time.Minute, settings.MaxBackoff)
+	assert.Equal(t, 2*time.Second, settings.OperationTimeout)
+	assert.Equal(t, 10*time.Second, settings.WatchdogTimeout)
+	assert.Equal(t, 0.6, settings.FailsafeDuty)
+
+	// The watchdog can't fire while the loop is still legitimately waiting on the sensor
+	_, err = ParseLoopSettings("fan", LoopConfig{OperationTimeout: 10, WatchdogTimeout: 10})
+	assert.ErrorContains(t, err, "watchdog_timeout")
+
+	_, err = ParseLoopSettings("fan", LoopConfig{OperationTimeout: -1})
+	assert.ErrorContains(t, err, "operation_timeout")
+
+	_, err = ParseLoopSettings("fan", LoopConfig{PollInterval: 0.001})
+	assert.ErrorContains(t, err, "poll_interval")
+
+	// A backoff shorter than the poll interval would speed the loop up
+	settings, err = ParseLoopSettings("fan", LoopConfig{PollInterval: 5, MaxBackoff: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, 5*time.Second, settings.MaxBackoff)
+
+	failsafe = 120
+	_, err = ParseLoopSettings("fan", LoopConfig{FailsafeDuty: &failsafe})
+	assert.ErrorContains(t, err, "failsafe_duty")
+}
+
+func TestWatchdog(t *testing.T) {
+	now := time.Now()
+	w := &Watchdog{}
+	w.SetTimeout(time.Second)
+
+	// Nothing has joined yet, so there's nothing to be healthy
+	healthy, _ := w.Health(now)
+	assert.False(t, healthy)
+
+	// Or until the loop gets through its first pass
+	first := w.Join(now)
+	healthy, _ = w.Health(now)
+	assert.False(t, healthy)
+	assert.True(t, w.Beat(first, now.Add(500*time.Millisecond), 0))
+	healthy, _ = w.Health(now.Add(time.Second))
+	assert.True(t, healthy)
+	healthy, _ = w.Health(now.Add(2 * time.Second))
+	assert.False(t, healthy)
+
+	// Once a new loop joins, the old one is told to exit
+	w.Restarted(now.Add(2 * time.Second))
+	second := w.Join(now.Add(2 * time.Second))
+	assert.False(t, w.Beat(first, now.Add(2*time.Second), 0))
+	assert.True(t, w.Beat(second, now.Add(2*time.Second), 0))
+	healthy, restarts := w.Health(now.Add(2 * time.Second))
+	assert.True(t, healthy)
+	assert.Equal(t, 1, restarts)
+
+	// A loop that's backing off isn't stuck
+	assert.True(t, w.Beat(second, now.Add(2*time.Second), 5*time.Second))
+	healthy, _ = w.Health(now.Add(7 * time.Second))
+	assert.True(t, healthy)
+}
+
+func TestWatchdogWatch(t *testing.T) {
+	w := &Watchdog{}
+	w.SetTimeout(200 * time.Millisecond)
+	w.Join(time.Now())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stalls := make(chan struct{}, 10)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		w.Watch(ctx, func() {
+			w.Restarted(time.Now())
+			stalls <- struct{}{}
+		})
+	}()
+
+	// Nobody is beating, so the watchdog fires
+	select {
+	case <-stalls:
+	case <-time.After(2 * time.Second):
+		t.Fatal("watchdog never fired")
+	}
+	cancel()
+	wg.Wait()
+}